@@ -0,0 +1,61 @@
+package resample
+
+// How the destination pixels are calculated from the source.
+type Mode int
+
+const (
+	// Resample with the filters of the Options, the default.
+	FilterMode Mode = iota
+
+	// Each destination pixel is the mean of the source area it covers,
+	// source pixels partially covered are weighted by their coverage
+	// (INTER_AREA of OpenCV). The filters and boundaries of the Options
+	// are ignored, the area never leaves the source.
+	//
+	// This keeps sums and means of the image, which makes it suited to
+	// data and chart images. When upscaling it is a pixel replication
+	// with blended edges.
+	AreaMode
+)
+
+func (m Mode) valid() bool {
+	return m == FilterMode || m == AreaMode
+}
+
+// The coverage weights of AreaMode. Destination pixel i covers the
+// source interval [i*nsrc, (i+1)*nsrc)/ndst, all sums are kept in
+// units of 1/ndst source pixels to stay exact.
+func makeAreaKernel(ndst, nsrc int) *kernel {
+	k := &kernel{spans: make([]kernelSpan, ndst)}
+	// The coverage repeats itself every q destination pixels.
+	g := gcd(ndst, nsrc)
+	q, p := ndst/g, nsrc/g
+
+	phases := make([]kernelSpan, q)
+	for r := range phases {
+		lo, hi := r*nsrc, (r+1)*nsrc
+		base := lo / ndst
+		start := int32(len(k.taps))
+		for j := base; j*ndst < hi; j++ {
+			a, b := j*ndst, (j+1)*ndst
+			if a < lo {
+				a = lo
+			}
+			if b > hi {
+				b = hi
+			}
+			if overlap := b - a; overlap > 0 {
+				k.taps = append(k.taps, kvPair{int32(j - base), float32(overlap) / float32(nsrc)})
+			}
+		}
+		phases[r] = kernelSpan{int32(base), start, int32(len(k.taps)) - start}
+	}
+	for i := range k.spans {
+		phase := phases[i%q]
+		phase.base += int32((i / q) * p)
+		k.spans[i] = phase
+		k.ops += int(phase.n)
+	}
+	k.finish(ndst, nsrc)
+	return k
+}
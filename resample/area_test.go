@@ -0,0 +1,60 @@
+package resample
+
+import (
+	"image"
+	"testing"
+)
+
+// A line of the values v as an NRGBAF32 image.
+func lineF32(v ...float32) *NRGBAF32 {
+	img := NewNRGBAF32(image.Rect(0, 0, len(v), 1))
+	for x, c := range v {
+		img.SetNRGBAF32(x, 0, NRGBAF32Color{c, c, c, 1})
+	}
+	return img
+}
+
+func TestAreaMode(t *testing.T) {
+	tests := []struct {
+		src, want []float32
+	}{
+		// Each target pixel covers 2.5 source pixels.
+		{[]float32{1, 2, 3, 4, 5}, []float32{(1 + 2 + 0.5*3) / 2.5, (0.5*3 + 4 + 5) / 2.5}},
+		{[]float32{0, 0, 0, 1, 1, 1}, []float32{0, 1}},
+		// Upscaling replicates with blended edges.
+		{[]float32{0, 1}, []float32{0, 0, 0.5, 1, 1}},
+	}
+	for _, tt := range tests {
+		dst := resizeF32(t, lineF32(tt.src...), image.Pt(len(tt.want), 1), Options{Mode: AreaMode})
+		for x, want := range tt.want {
+			if c := dst.NRGBAF32At(x, 0); abs32(c.R-want) > 1e-6 || c.A != 1 {
+				t.Errorf("%v to %d: pixel %d is %v, want %g", tt.src, len(tt.want), x, c, want)
+			}
+		}
+	}
+}
+
+func TestAreaModeKeepsMean(t *testing.T) {
+	src := NewNRGBAF32(image.Rect(0, 0, 37, 23))
+	var sum float64
+	for y := 0; y < 23; y++ {
+		for x := 0; x < 37; x++ {
+			v := float32((x*7+y*13)%17) / 16
+			src.SetNRGBAF32(x, y, NRGBAF32Color{v, v, v, 1})
+			sum += float64(v)
+		}
+	}
+	for _, size := range []image.Point{{10, 9}, {5, 23}, {1, 1}, {50, 31}} {
+		dst := resizeF32(t, src, size, Options{Mode: AreaMode})
+		var dstSum float64
+		for y := 0; y < size.Y; y++ {
+			for x := 0; x < size.X; x++ {
+				dstSum += float64(dst.NRGBAF32At(x, y).R)
+			}
+		}
+		mean, want := dstSum/float64(size.X*size.Y), sum/(37*23)
+		if d := mean - want; d > 1e-5 || d < -1e-5 {
+			t.Errorf("%v: mean %g, want %g", size, mean, want)
+		}
+	}
+}
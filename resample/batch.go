@@ -0,0 +1,174 @@
+package resample
+
+import (
+	"image"
+	"runtime"
+	"sync"
+)
+
+// A resize of a batch, see StartResize for the fields.
+type BatchTask struct {
+	Dst     image.Image
+	DstRect image.Rectangle
+	Src     image.Image
+	SrcRect image.Rectangle
+	Options Options
+}
+
+// The outcome of the task Index of a batch: the target image, or the
+// error of the arguments, ErrCanceled or the error the resize failed
+// with. Plan is the plan of the resize once it started, see Job.Plan.
+type BatchResult struct {
+	Index int
+	Image image.Image
+	Err   error
+	Plan  *Plan
+}
+
+// Runs batches of resizes on a bounded number of workers. A resize
+// runs in a single goroutine, so the workers are all the parallelism
+// there is. They are shared by all batches of a BatchResizer, which
+// may be used from any goroutine.
+type BatchResizer struct {
+	workers chan struct{}
+}
+
+// Creates a BatchResizer running at most workers resizes at a time,
+// GOMAXPROCS if workers isn't positive.
+func NewBatchResizer(workers int) *BatchResizer {
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	return &BatchResizer{workers: make(chan struct{}, workers)}
+}
+
+// The resizes of a batch started by BatchResizer.Start.
+type Batch struct {
+	tasks   []BatchTask
+	results chan BatchResult
+
+	cancel     chan struct{}
+	cancelOnce sync.Once
+	done       chan struct{}
+
+	// The job of each started task, the error of each task which
+	// couldn't be started.
+	mu   sync.Mutex
+	jobs []*Job
+	errs []error
+}
+
+// Starts the tasks in their order, each once a worker is free.
+func (r *BatchResizer) Start(tasks []BatchTask) *Batch {
+	b := &Batch{
+		tasks:   tasks,
+		results: make(chan BatchResult, len(tasks)),
+		cancel:  make(chan struct{}),
+		done:    make(chan struct{}),
+		jobs:    make([]*Job, len(tasks)),
+		errs:    make([]error, len(tasks)),
+	}
+	go b.dispatch(r.workers)
+	return b
+}
+
+func (b *Batch) dispatch(workers chan struct{}) {
+	var wg sync.WaitGroup
+	defer close(b.done)
+	defer close(b.results)
+	defer wg.Wait()
+
+	fail := func(i int, err error) {
+		b.mu.Lock()
+		b.errs[i] = err
+		b.mu.Unlock()
+		b.results <- BatchResult{Index: i, Err: err}
+	}
+	for i, t := range b.tasks {
+		canceled := false
+		select {
+		case workers <- struct{}{}:
+			// The select picks at random if Cancel was called by the
+			// time the worker got free.
+			select {
+			case <-b.cancel:
+				<-workers
+				canceled = true
+			default:
+			}
+		case <-b.cancel:
+			canceled = true
+		}
+		if canceled {
+			for ; i < len(b.tasks); i++ {
+				fail(i, ErrCanceled)
+			}
+			return
+		}
+		job, err := StartResize(t.Dst, t.DstRect, t.Src, t.SrcRect, t.Options)
+		if err != nil {
+			<-workers
+			fail(i, err)
+			continue
+		}
+		b.mu.Lock()
+		b.jobs[i] = job
+		b.mu.Unlock()
+		// Cancel may have missed the job.
+		select {
+		case <-b.cancel:
+			job.Cancel()
+		default:
+		}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			img, err := job.Wait()
+			<-workers
+			b.results <- BatchResult{Index: i, Image: img, Err: err, Plan: job.Plan()}
+		}(i)
+	}
+}
+
+// The result of each task once it is done, in the order they finish.
+// Buffered for all tasks and closed once the batch is done.
+func (b *Batch) Results() <-chan BatchResult {
+	return b.results
+}
+
+// The progress of each task, see Job.Progress. Tasks waiting for a
+// worker are at zero percent in PhaseSetup.
+func (b *Batch) Progress() []DetailedStep {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	steps := make([]DetailedStep, len(b.tasks))
+	for i, job := range b.jobs {
+		switch {
+		case job != nil:
+			steps[i] = job.Progress()
+		case b.errs[i] != nil:
+			steps[i] = step{phase: PhaseDone, err: b.errs[i]}
+		default:
+			steps[i] = step{}
+		}
+	}
+	return steps
+}
+
+// Cancels the running tasks and those not started yet, their results
+// are ErrCanceled. Tasks done already keep their results.
+func (b *Batch) Cancel() {
+	b.cancelOnce.Do(func() { close(b.cancel) })
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, job := range b.jobs {
+		if job != nil {
+			job.Cancel()
+		}
+	}
+}
+
+// Closed once all tasks are done and their workers free.
+func (b *Batch) Done() <-chan struct{} {
+	return b.done
+}
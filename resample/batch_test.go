@@ -0,0 +1,169 @@
+package resample
+
+import (
+	"image"
+	"testing"
+	"time"
+)
+
+// Collects the results of b by index, which must come once each.
+func batchResults(t *testing.T, b *Batch, n int) []BatchResult {
+	t.Helper()
+	results := make([]BatchResult, n)
+	seen := make([]bool, n)
+	for r := range b.Results() {
+		if seen[r.Index] {
+			t.Fatalf("second result of task %d", r.Index)
+		}
+		seen[r.Index], results[r.Index] = true, r
+	}
+	for i := range seen {
+		if !seen[i] {
+			t.Fatalf("no result of task %d", i)
+		}
+	}
+	<-b.Done()
+	return results
+}
+
+func TestBatch(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 60, 40))
+	dst := image.NewRGBA(image.Rect(0, 0, 30, 30))
+	tasks := []BatchTask{
+		{DstRect: image.Rect(0, 0, 20, 10), Src: src, SrcRect: src.Rect},
+		{DstRect: image.Rect(0, 0, 10, 10), SrcRect: src.Rect},
+		{Dst: dst, DstRect: image.Rect(5, 5, 25, 15), Src: src, SrcRect: src.Rect, Options: Options{Filter: Triangle}},
+		{DstRect: image.Rect(0, 0, 90, 50), Src: src, SrcRect: src.Rect, Options: Options{Mode: Mode(-1)}},
+	}
+	results := batchResults(t, NewBatchResizer(2).Start(tasks), len(tasks))
+	for i, want := range []error{nil, ErrSourceImageIsInvalid, nil, ErrInvalidMode} {
+		r := results[i]
+		if r.Err != want {
+			t.Errorf("task %d: error %v, want %v", i, r.Err, want)
+			continue
+		}
+		if want != nil {
+			if r.Image != nil || r.Plan != nil {
+				t.Errorf("task %d failed with an image %T or a plan", i, r.Image)
+			}
+			continue
+		}
+		if r.Image == nil || r.Plan == nil || r.Plan.Stats().Runs != 1 {
+			t.Errorf("task %d: image %T, plan %v", i, r.Image, r.Plan)
+		}
+	}
+	if results[2].Image != dst {
+		t.Errorf("task 2 resized into a %T of its own", results[2].Image)
+	}
+}
+
+func TestBatchWorkers(t *testing.T) {
+	src := image.NewNRGBA64(image.Rect(0, 0, 200, 200))
+	var tasks []BatchTask
+	for i := 0; i < 6; i++ {
+		tasks = append(tasks, BatchTask{DstRect: image.Rect(0, 0, 400, 400), Src: src, SrcRect: src.Rect,
+			Options: Options{Filter: Lanczos3}})
+	}
+	// Both batches share the two workers.
+	r := NewBatchResizer(2)
+	batches := []*Batch{r.Start(tasks), r.Start(tasks)}
+	most := 0
+	for done := false; !done; time.Sleep(time.Millisecond) {
+		running := 0
+		done = true
+		for _, b := range batches {
+			b.mu.Lock()
+			for _, job := range b.jobs {
+				if job == nil {
+					done = false
+					continue
+				}
+				select {
+				case <-job.Done():
+				default:
+					running++
+					done = false
+				}
+			}
+			b.mu.Unlock()
+		}
+		if running > most {
+			most = running
+		}
+	}
+	if most == 0 || most > 2 {
+		t.Errorf("%d resizes at a time, want at most 2", most)
+	}
+	for _, b := range batches {
+		for i, r := range batchResults(t, b, len(tasks)) {
+			if r.Err != nil {
+				t.Errorf("task %d: %v", i, r.Err)
+			}
+		}
+		for i, st := range b.Progress() {
+			if !st.Done() || st.Percent() != 100 {
+				t.Errorf("task %d at %d%%, done %v", i, st.Percent(), st.Done())
+			}
+		}
+	}
+}
+
+func TestBatchCancel(t *testing.T) {
+	src := image.NewNRGBA64(image.Rect(0, 0, 500, 500))
+	task := BatchTask{DstRect: image.Rect(0, 0, 2000, 2000), Src: src, SrcRect: src.Rect,
+		Options: Options{Filter: Lanczos12}}
+	b := NewBatchResizer(1).Start([]BatchTask{task, task, task})
+	// The first task is running, the others wait for the worker.
+	for b.Progress()[0].Percent() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for i, st := range b.Progress()[1:] {
+		if st.Done() || st.Phase() != PhaseSetup || st.Percent() != 0 {
+			t.Errorf("waiting task %d: %+v", i+1, st)
+		}
+	}
+	b.Cancel()
+	for i, r := range batchResults(t, b, 3) {
+		if r.Err != ErrCanceled || r.Image != nil {
+			t.Errorf("task %d: image %T, error %v, want ErrCanceled", i, r.Image, r.Err)
+		}
+	}
+	for i, st := range b.Progress() {
+		if !st.Done() || st.Err() != ErrCanceled {
+			t.Errorf("task %d after Cancel: %+v", i, st)
+		}
+	}
+}
+
+func TestBatchCancelWaiting(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 4, 4))
+	tasks := []BatchTask{
+		{DstRect: image.Rect(0, 0, 2, 2), Src: src, SrcRect: src.Rect},
+		{DstRect: image.Rect(0, 0, 2, 2), SrcRect: src.Rect},
+		{DstRect: image.Rect(0, 0, 2, 2), Src: src, SrcRect: src.Rect},
+	}
+	r := NewBatchResizer(2)
+	// Both workers are taken when Cancel is called and get free right
+	// after it, the tasks must not start then.
+	for n := 0; n < 50; n++ {
+		r.workers <- struct{}{}
+		r.workers <- struct{}{}
+		b := r.Start(tasks)
+		b.Cancel()
+		<-r.workers
+		<-r.workers
+		for i, res := range batchResults(t, b, len(tasks)) {
+			if res.Err != ErrCanceled || res.Image != nil || res.Plan != nil {
+				t.Fatalf("task %d: image %T, error %v, want ErrCanceled", i, res.Image, res.Err)
+			}
+		}
+		for i, job := range b.jobs {
+			if job != nil {
+				t.Fatalf("task %d started after Cancel", i)
+			}
+		}
+		if len(r.workers) != 0 {
+			t.Fatalf("%d workers still taken", len(r.workers))
+		}
+	}
+}
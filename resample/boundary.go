@@ -0,0 +1,87 @@
+package resample
+
+import (
+	"image/color"
+)
+
+// A Boundary defines how the filter treats samples outside of the
+// source image. It is chosen per axis.
+//
+// Every WrapFunc is a Boundary, so Clamp, Reject, Reflect, Mirror and
+// Tile can be used via a conversion such as WrapFunc(Clamp). Constant
+// borders are created via Constant.
+type Boundary interface {
+	// Map the sample x to the range [min,max] or return -1 to reject it.
+	Wrap(x, min, max int) int
+}
+
+func (w WrapFunc) Wrap(x, min, max int) int {
+	return w(x, min, max)
+}
+
+// Boundaries which replace rejected samples with a colour
+// instead of dropping them.
+type borderBoundary interface {
+	Boundary
+	border() f32RGBA
+}
+
+type constantBoundary struct {
+	c f32RGBA
+}
+
+func (b constantBoundary) Wrap(x, min, max int) int {
+	return Reject(x, min, max)
+}
+
+func (b constantBoundary) border() f32RGBA {
+	return b.c
+}
+
+// The filter sees the color c everywhere outside of the image.
+func Constant(c color.Color) Boundary {
+	n := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+	return constantBoundary{f32RGBA{
+		R: uint16_to_f32 * float32(n.R),
+		G: uint16_to_f32 * float32(n.G),
+		B: uint16_to_f32 * float32(n.B),
+		A: uint16_to_f32 * float32(n.A),
+	}}
+}
+
+// Like Reflect, but the boundary pixel is repeated.
+//
+// The picture is mirrored as often as needed, so filters with a support
+// larger than the image are handled too.
+func Mirror(x, min, max int) int {
+	n := max - min + 1
+	if n <= 0 {
+		return -1
+	}
+	x = mod(x-min, 2*n)
+	if x >= n {
+		x = 2*n - 1 - x
+	}
+	return x + min
+}
+
+// Repeat the image in all directions, also called repeat or wrap.
+func Tile(x, min, max int) int {
+	n := max - min + 1
+	if n <= 0 {
+		return -1
+	}
+	return mod(x-min, n) + min
+}
+
+// Another name for Tile.
+var Repeat WrapFunc = Tile
+
+// Modulus which is never negative.
+func mod(x, n int) int {
+	x %= n
+	if x < 0 {
+		x += n
+	}
+	return x
+}
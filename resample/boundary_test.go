@@ -0,0 +1,92 @@
+package resample
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestWrapFuncs(t *testing.T) {
+	// The samples -7..9 of an image of the pixels 0..3.
+	tests := []struct {
+		name string
+		f    WrapFunc
+		want []int
+	}{
+		{"Clamp", Clamp, []int{0, 0, 0, 0, 0, 0, 0, 0, 1, 2, 3, 3, 3, 3, 3, 3, 3}},
+		{"Reject", Reject, []int{-1, -1, -1, -1, -1, -1, -1, 0, 1, 2, 3, -1, -1, -1, -1, -1, -1}},
+		{"Reflect", Reflect, []int{1, 0, 1, 2, 3, 2, 1, 0, 1, 2, 3, 2, 1, 0, 1, 2, 3}},
+		{"Mirror", Mirror, []int{1, 2, 3, 3, 2, 1, 0, 0, 1, 2, 3, 3, 2, 1, 0, 0, 1}},
+		{"Tile", Tile, []int{1, 2, 3, 0, 1, 2, 3, 0, 1, 2, 3, 0, 1, 2, 3, 0, 1}},
+	}
+	for _, tt := range tests {
+		for i, want := range tt.want {
+			x := i - 7
+			if got := tt.f(x, 0, 3); got != want {
+				t.Errorf("%s(%d, 0, 3) = %d, want %d", tt.name, x, got, want)
+			}
+		}
+	}
+}
+
+func TestWrapFuncsStayInRange(t *testing.T) {
+	// Supports much larger than the image are mirrored repeatedly.
+	for _, f := range []WrapFunc{Clamp, Reflect, Mirror, Tile} {
+		for _, n := range []int{1, 2, 5} {
+			for x := -100; x <= 100; x++ {
+				if got := f(x, 10, 10+n-1); got < 10 || got > 10+n-1 {
+					t.Fatalf("wrap(%d, 10, %d) = %d, out of range", x, 10+n-1, got)
+				}
+			}
+		}
+	}
+}
+
+// Shrinks a white image with the boundary on both axes. The filter of
+// the corner pixel reaches beyond the source, that of the centre doesn't.
+func shrinkWhite(t *testing.T, b Boundary) *image.NRGBA64 {
+	src := image.NewNRGBA64(image.Rect(0, 0, 8, 8))
+	for i := range src.Pix {
+		src.Pix[i] = 0xff
+	}
+	steps, _, err := ResizeToChannelWithBoundary(nil, image.Rect(0, 0, 3, 3), src, src.Bounds(), Triangle, b, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for st := range steps {
+		if st.Done() {
+			return st.Image().(*image.NRGBA64)
+		}
+	}
+	t.Fatal("no done step")
+	return nil
+}
+
+func TestConstantBoundary(t *testing.T) {
+	black := shrinkWhite(t, Constant(color.Black))
+	clamped := shrinkWhite(t, WrapFunc(Clamp))
+	corner, centre := black.NRGBA64At(0, 0), black.NRGBA64At(1, 1)
+	if corner.R >= centre.R || corner.A < 0xfffe {
+		t.Errorf("Constant(black): corner %v not darker than centre %v", corner, centre)
+	}
+	if c := clamped.NRGBA64At(0, 0); c.R < 0xff00 {
+		t.Errorf("Clamp: corner %v, want white", c)
+	}
+
+	// A transparent border fades the alpha channel instead.
+	transparent := shrinkWhite(t, Constant(color.Transparent))
+	if c := transparent.NRGBA64At(0, 0); c.A >= 0xff00 {
+		t.Errorf("Constant(transparent): corner %v, want translucent", c)
+	}
+}
+
+func TestNilBoundaries(t *testing.T) {
+	src := image.NewNRGBA64(image.Rect(0, 0, 4, 4))
+	if _, _, err := ResizeToChannelWithFilter(nil, image.Rect(0, 0, 2, 2), src, src.Bounds(), Box, nil, Clamp); err != ErrMissingWrapFunc {
+		t.Errorf("nil WrapFunc: %v, want ErrMissingWrapFunc", err)
+	}
+	var nilWrap WrapFunc
+	if _, _, err := ResizeToChannelWithBoundary(nil, image.Rect(0, 0, 2, 2), src, src.Bounds(), Box, nilWrap, WrapFunc(Clamp)); err != ErrMissingBoundary {
+		t.Errorf("nil WrapFunc as Boundary: %v, want ErrMissingBoundary", err)
+	}
+}
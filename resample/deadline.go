@@ -0,0 +1,211 @@
+package resample
+
+import (
+	"image"
+	"math"
+	"sync/atomic"
+	"time"
+)
+
+// The quality levels of Options.Deadline, from the best to the fastest.
+type Quality int
+
+const (
+	// The filters of the options as given.
+	QualityRequested Quality = iota
+	// Filters with a larger support than CatmullRom replaced by it.
+	QualityCatmullRom
+	// Filters with a larger support than Triangle replaced by it.
+	QualityTriangle
+	// Triangle after the box filter of Options.Shrink.
+	QualityShrink
+)
+
+func (q Quality) String() string {
+	switch q {
+	case QualityRequested:
+		return "requested"
+	case QualityCatmullRom:
+		return "CatmullRom"
+	case QualityTriangle:
+		return "Triangle"
+	case QualityShrink:
+		return "Triangle after Shrink"
+	}
+	return "unknown quality"
+}
+
+// The normalized options o degraded to quality q. Filters are only
+// replaced by cheaper ones, AreaMode ignores them anyway.
+func (o Options) atQuality(q Quality) Options {
+	cheaper := func(f, g Filter) Filter {
+		if f.Support <= g.Support {
+			return f
+		}
+		return g
+	}
+	limit := CatmullRom
+	switch q {
+	case QualityRequested:
+		return o
+	case QualityShrink:
+		o.Shrink = true
+		fallthrough
+	case QualityTriangle:
+		limit = Triangle
+	}
+	o.Filter = cheaper(o.Filter, limit)
+	o.XFilter = cheaper(o.XFilter, limit)
+	o.YFilter = cheaper(o.YFilter, limit)
+	if o.AlphaFilter.isSet() {
+		o.AlphaFilter = cheaper(o.AlphaFilter, limit)
+	}
+	return o
+}
+
+// The best quality level predicted to finish by Options.Deadline of the
+// normalized options. If none is, the one predicted to be the fastest:
+// the shrink stage moves more pixels, which may cost more than the taps
+// it saves. Levels not predicted to be faster than the one before are
+// skipped.
+func chooseQuality(dst image.Image, dstRect image.Rectangle,
+	src image.Image, srcRect image.Rectangle, opt Options) Quality {
+	left := opt.Deadline.Sub(time.Now())
+	fastest, least := QualityRequested, time.Duration(math.MaxInt64)
+	for q := QualityRequested; q <= QualityShrink; q++ {
+		d := costs.estimate(dst, dstRect, src, srcRect, opt.atQuality(q))
+		if d >= least {
+			continue
+		}
+		if d <= left {
+			return q
+		}
+		fastest, least = q, d
+	}
+	return fastest
+}
+
+// The taps of resampling nsrc samples into ndst with f, about: the
+// window of the filter at the scale, capped by the source. The kernel
+// itself isn't built, see minKernelBytes.
+func axisTaps(f Filter, ndst, nsrc int) int {
+	scale := float64(nsrc) / float64(ndst)
+	if scale < 1 {
+		scale = 1
+	}
+	taps := int(math.Ceil(2 * f.Support * scale))
+	if taps > nsrc {
+		taps = nsrc
+	}
+	return maxInt(taps, 1) * ndst
+}
+
+// The pipeline, taps and pixels of a resize with the normalized options
+// o as predicted from the sizes and the filter supports, without
+// building the filter tables. The pass order is chosen like planPasses
+// does.
+func estimateWork(dst image.Image, dstRect image.Rectangle,
+	src image.Image, srcRect image.Rectangle, o Options) (k, ops, pixels int) {
+	if fixedImages(dst, src) && !o.AlphaFilter.isSet() {
+		k = 1
+	}
+	tmpPixelBytes := 16
+	switch {
+	case isGray(dst) && isGray(src):
+		tmpPixelBytes = 4
+	case k == 1 || o.HalfFloatIntermediate:
+		tmpPixelBytes = 8
+	}
+	stage := func(ndst, nsrc image.Point, xFilter, yFilter Filter) {
+		xy_ops := axisTaps(yFilter, ndst.Y, nsrc.Y)*nsrc.X + axisTaps(xFilter, ndst.X, nsrc.X)*ndst.Y
+		yx_ops := axisTaps(xFilter, ndst.X, nsrc.X)*nsrc.Y + axisTaps(yFilter, ndst.Y, nsrc.Y)*ndst.X
+		xy_cost := xy_ops + trafficCost(nsrc.X*ndst.Y*tmpPixelBytes)
+		yx_cost := yx_ops + trafficCost(ndst.X*nsrc.Y*tmpPixelBytes)
+		tmp := ndst.X * nsrc.Y
+		if xy_cost < yx_cost {
+			yx_ops, tmp = xy_ops, nsrc.X*ndst.Y
+		}
+		ops += yx_ops
+		pixels += nsrc.X*nsrc.Y + 2*tmp + ndst.X*ndst.Y
+	}
+	mainSize := srcRect.Size()
+	if o.Shrink && o.Mode == FilterMode {
+		if size := shrinkSize(dstRect.Size(), mainSize); size != mainSize {
+			stage(size, mainSize, Box, Box)
+			mainSize = size
+		}
+	}
+	stage(dstRect.Size(), mainSize, o.XFilter, o.YFilter)
+	return k, ops, pixels
+}
+
+// Pixels read or written by the passes of e.
+func (e *execution) pixels() int {
+	stage := func(r resizePasses, dstRect, srcRect image.Rectangle) int {
+		tmp := r.tmpBounds.Dx() * r.tmpBounds.Dy()
+		if r.rows > 0 {
+			tmp = r.tmpBounds.Dx() * r.stripRows
+		}
+		return srcRect.Dx()*srcRect.Dy() + 2*tmp + dstRect.Dx()*dstRect.Dy()
+	}
+	p := e.plan
+	if e.shrunk == nil {
+		return stage(e.main, p.dstRect, p.srcRect)
+	}
+	return stage(e.shrink, p.shrinkRect, p.srcRect) + stage(e.main, p.dstRect, p.shrinkRect)
+}
+
+// The time a resize takes, per tap and per pixel moved, for the float
+// and the fixed point pipeline. Fitted on an amd64 machine with AVX2
+// by BenchmarkCostModel.
+//
+// Each pipeline has a scale, in 1/1024, for the machine the package
+// runs on. It follows the ratio of the measured to the predicted time
+// of the resizes so far.
+type costModel struct {
+	scale [2]int64
+}
+
+var (
+	tapNanos   = [2]float64{1.0, 3.7}
+	pixelNanos = [2]float64{20, 11}
+	costs      = costModel{scale: [2]int64{1024, 1024}}
+)
+
+func pipeline(e *execution) int {
+	if e.main.fixed {
+		return 1
+	}
+	return 0
+}
+
+// The time of the work of estimateWork.
+func (c *costModel) estimate(dst image.Image, dstRect image.Rectangle,
+	src image.Image, srcRect image.Rectangle, o Options) time.Duration {
+	k, ops, pixels := estimateWork(dst, dstRect, src, srcRect, o)
+	return c.time(k, ops, pixels)
+}
+
+func (c *costModel) time(k, ops, pixels int) time.Duration {
+	ns := tapNanos[k]*float64(ops) + pixelNanos[k]*float64(pixels)
+	return time.Duration(ns * float64(atomic.LoadInt64(&c.scale[k])) / 1024)
+}
+
+// Adjusts the scale by a resize which took d.
+func (c *costModel) observe(e *execution, d time.Duration) {
+	k := pipeline(e)
+	ns := tapNanos[k]*float64(e.ops()) + pixelNanos[k]*float64(e.pixels())
+	if ns < 1e6 {
+		// Too short to tell.
+		return
+	}
+	ratio := float64(d) / ns
+	if ratio < 1.0/8 {
+		ratio = 1.0 / 8
+	} else if ratio > 8 {
+		ratio = 8
+	}
+	// Races between resizes lose an update at worst.
+	old := atomic.LoadInt64(&c.scale[k])
+	atomic.StoreInt64(&c.scale[k], (3*old+int64(ratio*1024))/4)
+}
@@ -0,0 +1,144 @@
+package resample
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"testing"
+	"time"
+)
+
+func TestEstimateWork(t *testing.T) {
+	tests := []struct {
+		dst, src image.Rectangle
+		opt      Options
+	}{
+		{image.Rect(0, 0, 300, 200), image.Rect(0, 0, 100, 80), Options{Filter: Lanczos3}},
+		{image.Rect(0, 0, 90, 70), image.Rect(0, 0, 700, 500), Options{Filter: CatmullRom}},
+		{image.Rect(0, 0, 90, 70), image.Rect(0, 0, 700, 500), Options{Filter: Triangle, Shrink: true}},
+		{image.Rect(0, 0, 40, 600), image.Rect(0, 0, 500, 100), Options{Filter: Lanczos12}},
+	}
+	for _, test := range tests {
+		opt, err := test.opt.normalize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, dst := range []image.Image{image.NewNRGBA(test.dst), image.NewNRGBA64(test.dst)} {
+			src := image.NewNRGBA(test.src)
+			e, _ := newPlan(test.dst, test.src, opt).start(dst, src, nil, false)
+			k, ops, pixels := estimateWork(dst, test.dst, src, test.src, opt)
+			if k != pipeline(&e) {
+				t.Errorf("%T %v to %v: pipeline %d, want %d", dst, test.src, test.dst, k, pipeline(&e))
+			}
+			// The boundaries and the zeros of the filters drop taps.
+			if r := float64(ops) / float64(e.ops()); r < 1 || r > 1.5 {
+				t.Errorf("%T %v to %v: %d taps estimated, %d planned", dst, test.src, test.dst, ops, e.ops())
+			}
+			if pixels != e.pixels() {
+				t.Errorf("%T %v to %v: %d pixels estimated, %d planned", dst, test.src, test.dst, pixels, e.pixels())
+			}
+		}
+	}
+}
+
+func TestQualityOrder(t *testing.T) {
+	opt, err := Options{Filter: Lanczos12}.normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The fixed point pipeline is faster the cheaper the level. The
+	// source pixels aren't needed.
+	dst, dstRect := image.NewNRGBA(image.Rectangle{}), image.Rect(0, 0, 100, 100)
+	src, srcRect := image.NewNRGBA(image.Rectangle{}), image.Rect(0, 0, 4000, 4000)
+	var d [QualityShrink + 1]time.Duration
+	for q := range d {
+		d[q] = costs.estimate(dst, dstRect, src, srcRect, opt.atQuality(Quality(q)))
+		if q > 0 && d[q] >= d[q-1] {
+			t.Fatalf("%v estimated %v, %v %v", Quality(q), d[q], Quality(q-1), d[q-1])
+		}
+	}
+	for q := range d {
+		// Between the estimates of the level and the one before.
+		left := 2 * d[0]
+		if q > 0 {
+			left = (d[q] + d[q-1]) / 2
+		}
+		opt.Deadline = time.Now().Add(left)
+		if got := chooseQuality(dst, dstRect, src, srcRect, opt); got != Quality(q) {
+			t.Errorf("%v left: %v, want %v", left, got, Quality(q))
+		}
+	}
+	opt.Deadline = time.Now().Add(-time.Second)
+	if got := chooseQuality(dst, dstRect, src, srcRect, opt); got != QualityShrink {
+		t.Errorf("late: %v, want %v", got, QualityShrink)
+	}
+
+	// Into a float image the pixels of the shrink stage cost more
+	// than the taps it saves, Triangle is the fastest.
+	dstRect, srcRect = image.Rect(0, 0, 300, 300), image.Rect(0, 0, 2000, 2000)
+	triangle := costs.estimate(nil, dstRect, src, srcRect, opt.atQuality(QualityTriangle))
+	shrink := costs.estimate(nil, dstRect, src, srcRect, opt.atQuality(QualityShrink))
+	if shrink <= triangle {
+		t.Fatalf("shrink estimated %v, Triangle %v", shrink, triangle)
+	}
+	if got := chooseQuality(nil, dstRect, src, srcRect, opt); got != QualityTriangle {
+		t.Errorf("late into NRGBA64: %v, want %v", got, QualityTriangle)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 400, 400))
+	for _, deadline := range []time.Time{{}, time.Now().Add(time.Hour), time.Now().Add(-time.Second)} {
+		job, err := StartResize(nil, image.Rect(0, 0, 50, 50), src, src.Rect, Options{Deadline: deadline})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := job.Wait(); err != nil {
+			t.Fatal(err)
+		}
+		q := job.Progress().Quality()
+		if late := deadline.Before(time.Now()) && !deadline.IsZero(); late == (q == QualityRequested) {
+			t.Errorf("deadline %v: %v", deadline, q)
+		}
+		if plan := job.Plan(); plan.Quality() != q || plan.shrink != (q == QualityShrink) {
+			t.Errorf("deadline %v: %v, plan %v with shrink stage %v", deadline, q, plan.Quality(), plan.shrink)
+		}
+	}
+}
+
+// Fits tapNanos and pixelNanos of the cost model for both pipelines
+// from a resize with few taps per pixel and one with many:
+// go test -run - -bench CostModel -v
+func BenchmarkCostModel(b *testing.B) {
+	images := []func(image.Rectangle) draw.Image{
+		func(r image.Rectangle) draw.Image { return image.NewNRGBA64(r) },
+		func(r image.Rectangle) draw.Image { return image.NewNRGBA(r) },
+	}
+	for k, newImage := range images {
+		var ops, pixels, nanos [2]float64
+		for i, f := range []Filter{Box, Lanczos12} {
+			src, dst := newImage(image.Rect(0, 0, 1000, 1000)), newImage(image.Rect(0, 0, 700, 700))
+			plan, err := Prepare(dst.Bounds(), src.Bounds(), Options{Filter: f})
+			if err != nil {
+				b.Fatal(err)
+			}
+			e, _ := plan.start(dst, src, nil, false)
+			if pipeline(&e) != k {
+				b.Fatalf("%T uses pipeline %d", dst, pipeline(&e))
+			}
+			s := new(Scratch)
+			t := time.Now()
+			for n := 0; n < b.N; n++ {
+				ResizeIntoWithScratch(dst, src, plan, s)
+			}
+			nanos[i] = float64(time.Since(t)) / float64(b.N)
+			ops[i], pixels[i] = float64(e.ops()), float64(e.pixels())
+		}
+		det := ops[0]*pixels[1] - ops[1]*pixels[0]
+		tap := (nanos[0]*pixels[1] - nanos[1]*pixels[0]) / det
+		pixel := (ops[0]*nanos[1] - ops[1]*nanos[0]) / det
+		b.Logf("tapNanos[%d] = %.2f, pixelNanos[%d] = %.1f", k, tap, k, pixel)
+		b.ReportMetric(tap, fmt.Sprintf("tapNanos%d", k))
+		b.ReportMetric(pixel, fmt.Sprintf("pixelNanos%d", k))
+	}
+}
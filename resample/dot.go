@@ -0,0 +1,34 @@
+package resample
+
+// The tap accumulation of resampleAxis, where the time is spent.
+//
+// The first assembly implementation the CPU supports, see dotRGBAImpls,
+// else the pure Go version. Building with the purego tag keeps the
+// pure Go version. The assembly doesn't check bounds, all taps have to
+// index column.
+var dotRGBA = func() func([]f32RGBA, []kvPair) f32RGBA {
+	if impls := dotRGBAImpls(); len(impls) > 0 {
+		return impls[0]
+	}
+	return dotRGBAGeneric
+}()
+
+// Sum of column[k]*v over all taps.
+func dotRGBAGeneric(column []f32RGBA, taps []kvPair) f32RGBA {
+	var dst_c f32RGBA
+	for _, f_y := range taps {
+		src_c := &column[f_y.k]
+		dst_c.R += f_y.v * src_c.R
+		dst_c.G += f_y.v * src_c.G
+		dst_c.B += f_y.v * src_c.B
+		dst_c.A += f_y.v * src_c.A
+	}
+	return dst_c
+}
+
+func abs32(x float32) float32 {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,42 @@
+//go:build !purego
+// +build !purego
+
+package resample
+
+// Implemented in dot_amd64.s.
+func dotRGBASSE(column []f32RGBA, taps []kvPair) f32RGBA
+func dotRGBAAVX2(column []f32RGBA, taps []kvPair) f32RGBA
+func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+func xgetbv() (eax, edx uint32)
+
+// Supports the AVX2 implementation, which also uses FMA instructions.
+func hasAVX2FMA() bool {
+	maxID, _, _, _ := cpuid(0, 0)
+	if maxID < 7 {
+		return false
+	}
+	_, _, ecx1, _ := cpuid(1, 0)
+	const (
+		fma     = 1 << 12
+		osxsave = 1 << 27
+		avx     = 1 << 28
+	)
+	if ecx1&(fma|osxsave|avx) != fma|osxsave|avx {
+		return false
+	}
+	// The OS has to save the XMM and YMM registers.
+	if xcr0, _ := xgetbv(); xcr0&6 != 6 {
+		return false
+	}
+	_, ebx7, _, _ := cpuid(7, 0)
+	const avx2 = 1 << 5
+	return ebx7&avx2 != 0
+}
+
+// SSE2 is part of every amd64 CPU.
+func dotRGBAImpls() []func([]f32RGBA, []kvPair) f32RGBA {
+	if hasAVX2FMA() {
+		return []func([]f32RGBA, []kvPair) f32RGBA{dotRGBAAVX2, dotRGBASSE}
+	}
+	return []func([]f32RGBA, []kvPair) f32RGBA{dotRGBASSE}
+}
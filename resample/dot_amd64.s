@@ -0,0 +1,114 @@
+//go:build !purego
+// +build !purego
+
+#include "textflag.h"
+
+// Each f32RGBA is one XMM register, each kvPair is an int32 index
+// followed by a float32 weight.
+
+// func dotRGBASSE(column []f32RGBA, taps []kvPair) f32RGBA
+TEXT ·dotRGBASSE(SB), NOSPLIT, $0-64
+	MOVQ column_base+0(FP), SI
+	MOVQ taps_base+24(FP), DI
+	MOVQ taps_len+32(FP), CX
+	XORPS X0, X0
+	XORPS X1, X1
+	CMPQ CX, $2
+	JB   sse_tail
+
+	// Two taps per iteration with separate sums.
+sse_pairs:
+	MOVLQSX 0(DI), AX
+	MOVLQSX 8(DI), BX
+	SHLQ    $4, AX
+	SHLQ    $4, BX
+	MOVSS   4(DI), X2
+	MOVSS   12(DI), X3
+	SHUFPS  $0, X2, X2
+	SHUFPS  $0, X3, X3
+	MOVUPS  (SI)(AX*1), X4
+	MOVUPS  (SI)(BX*1), X5
+	MULPS   X4, X2
+	MULPS   X5, X3
+	ADDPS   X2, X0
+	ADDPS   X3, X1
+	ADDQ    $16, DI
+	SUBQ    $2, CX
+	CMPQ    CX, $2
+	JAE     sse_pairs
+
+sse_tail:
+	ADDPS X1, X0
+	TESTQ CX, CX
+	JZ    sse_done
+	MOVLQSX 0(DI), AX
+	SHLQ    $4, AX
+	MOVSS   4(DI), X2
+	SHUFPS  $0, X2, X2
+	MOVUPS  (SI)(AX*1), X4
+	MULPS   X4, X2
+	ADDPS   X2, X0
+
+sse_done:
+	MOVUPS X0, ret+48(FP)
+	RET
+
+// func dotRGBAAVX2(column []f32RGBA, taps []kvPair) f32RGBA
+TEXT ·dotRGBAAVX2(SB), NOSPLIT, $0-64
+	MOVQ   column_base+0(FP), SI
+	MOVQ   taps_base+24(FP), DI
+	MOVQ   taps_len+32(FP), CX
+	VXORPS Y0, Y0, Y0
+	CMPQ   CX, $2
+	JB     avx_tail
+
+	// Two taps per iteration in the lower and upper lane.
+avx_pairs:
+	MOVLQSX      0(DI), AX
+	MOVLQSX      8(DI), BX
+	SHLQ         $4, AX
+	SHLQ         $4, BX
+	VMOVUPS      (SI)(AX*1), X2
+	VINSERTF128  $1, (SI)(BX*1), Y2, Y2
+	VBROADCASTSS 4(DI), X3
+	VBROADCASTSS 12(DI), X4
+	VINSERTF128  $1, X4, Y3, Y3
+	VFMADD231PS  Y3, Y2, Y0
+	ADDQ         $16, DI
+	SUBQ         $2, CX
+	CMPQ         CX, $2
+	JAE          avx_pairs
+
+avx_tail:
+	VEXTRACTF128 $1, Y0, X1
+	VADDPS       X1, X0, X0
+	TESTQ        CX, CX
+	JZ           avx_done
+	MOVLQSX      0(DI), AX
+	SHLQ         $4, AX
+	VBROADCASTSS 4(DI), X3
+	VFMADD231PS  (SI)(AX*1), X3, X0
+
+avx_done:
+	VMOVUPS    X0, ret+48(FP)
+	VZEROUPPER
+	RET
+
+// func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+TEXT ·cpuid(SB), NOSPLIT, $0-24
+	MOVL eaxArg+0(FP), AX
+	MOVL ecxArg+4(FP), CX
+	CPUID
+	MOVL AX, eax+8(FP)
+	MOVL BX, ebx+12(FP)
+	MOVL CX, ecx+16(FP)
+	MOVL DX, edx+20(FP)
+	RET
+
+// func xgetbv() (eax, edx uint32)
+TEXT ·xgetbv(SB), NOSPLIT, $0-8
+	MOVL   $0, CX
+	XGETBV
+	MOVL   AX, eax+0(FP)
+	MOVL   DX, edx+4(FP)
+	RET
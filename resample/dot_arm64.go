@@ -0,0 +1,12 @@
+//go:build !purego
+// +build !purego
+
+package resample
+
+// Implemented in dot_arm64.s.
+func dotRGBANEON(column []f32RGBA, taps []kvPair) f32RGBA
+
+// NEON is part of every arm64 CPU.
+func dotRGBAImpls() []func([]f32RGBA, []kvPair) f32RGBA {
+	return []func([]f32RGBA, []kvPair) f32RGBA{dotRGBANEON}
+}
@@ -0,0 +1,51 @@
+//go:build !purego
+// +build !purego
+
+#include "textflag.h"
+
+// Each f32RGBA is one vector register, each kvPair is an int32 index
+// followed by a float32 weight.
+
+// func dotRGBANEON(column []f32RGBA, taps []kvPair) f32RGBA
+TEXT ·dotRGBANEON(SB), NOSPLIT, $0-64
+	MOVD column_base+0(FP), R0
+	MOVD taps_base+24(FP), R1
+	MOVD taps_len+32(FP), R2
+	VEOR V0.B16, V0.B16, V0.B16
+	VEOR V1.B16, V1.B16, V1.B16
+	CMP  $2, R2
+	BLT  tail
+
+	// Two taps per iteration with separate sums.
+pairs:
+	MOVW  (R1), R3
+	MOVW  8(R1), R4
+	ADD   R3<<4, R0, R3
+	ADD   R4<<4, R0, R4
+	VLD1  (R3), [V2.S4]
+	VLD1  (R4), [V3.S4]
+	ADD   $4, R1, R5
+	ADD   $12, R1, R6
+	VLD1R (R5), [V4.S4]
+	VLD1R (R6), [V5.S4]
+	VFMLA V2.S4, V4.S4, V0.S4
+	VFMLA V3.S4, V5.S4, V1.S4
+	ADD   $16, R1
+	SUB   $2, R2
+	CMP   $2, R2
+	BGE   pairs
+
+tail:
+	VFADD V1.S4, V0.S4, V0.S4
+	CBZ   R2, done
+	MOVW  (R1), R3
+	ADD   R3<<4, R0, R3
+	VLD1  (R3), [V2.S4]
+	ADD   $4, R1, R5
+	VLD1R (R5), [V4.S4]
+	VFMLA V2.S4, V4.S4, V0.S4
+
+done:
+	MOVD $ret+48(FP), R7
+	VST1 [V0.S4], (R7)
+	RET
@@ -0,0 +1,8 @@
+//go:build (!amd64 && !arm64) || purego
+// +build !amd64,!arm64 purego
+
+package resample
+
+func dotRGBAImpls() []func([]f32RGBA, []kvPair) f32RGBA {
+	return nil
+}
@@ -0,0 +1,70 @@
+package resample
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// The implementations may sum in a different order or use fused
+// multiply adds, so a small relative error is accepted.
+func dotClose(want, got f32RGBA) bool {
+	for _, d := range [...][2]float32{
+		{want.R, got.R}, {want.G, got.G}, {want.B, got.B}, {want.A, got.A}} {
+		tolerance := 1e-5 * maxF32(1, abs32(d[0]))
+		if !(abs32(d[0]-d[1]) <= tolerance) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestDotRGBAImpls(t *testing.T) {
+	impls := dotRGBAImpls()
+	if len(impls) == 0 {
+		t.Skip("no assembly implementation")
+	}
+	rnd := rand.New(rand.NewSource(1))
+	nan := float32(math.NaN())
+	poison := f32RGBA{nan, nan, nan, nan}
+	for n := 1; n <= 40; n++ {
+		// The column ends with the border colour at index n-1 and is
+		// followed by NaN, as are the taps, in the same array. Reading
+		// beyond either slice taints the sum.
+		columnArray := make([]f32RGBA, n+4)
+		for i := range columnArray {
+			columnArray[i] = poison
+		}
+		column := columnArray[:n:n]
+		for i := range column {
+			column[i] = f32RGBA{rnd.Float32(), rnd.Float32(), rnd.Float32()*4 - 2, rnd.Float32()}
+		}
+		for ntaps := 0; ntaps <= 33; ntaps++ {
+			tapsArray := make([]kvPair, ntaps+4)
+			for i := range tapsArray {
+				tapsArray[i] = kvPair{int32(n), nan}
+			}
+			taps := tapsArray[:ntaps:ntaps]
+			for i := range taps {
+				taps[i] = kvPair{int32(rnd.Intn(n)), rnd.Float32()*2 - 0.5}
+			}
+			if ntaps > 0 {
+				taps[ntaps-1].k = int32(n - 1)
+			}
+			want := dotRGBAGeneric(column, taps)
+			for i, impl := range impls {
+				if got := impl(column, taps); !dotClose(want, got) {
+					t.Fatalf("implementation %d with %d taps into %d pixels: %v, want %v", i, ntaps, n, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestDotRGBASelected(t *testing.T) {
+	column := []f32RGBA{{1, 2, 3, 4}, {0.5, 0.25, 0, 1}, {-1, 0, 1, 0}}
+	taps := []kvPair{{2, 0.5}, {0, 0.25}, {1, -1}}
+	if got, want := dotRGBA(column, taps), dotRGBAGeneric(column, taps); !dotClose(want, got) {
+		t.Errorf("dotRGBA = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,277 @@
+package resample
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// An axis of an image.
+type Axis int
+
+const (
+	XAxis Axis = iota
+	YAxis
+)
+
+func (a Axis) String() string {
+	if a == XAxis {
+		return "x"
+	}
+	return "y"
+}
+
+// One pass of a resize, which resamples one axis of an image.
+type Pass struct {
+	Axis Axis
+
+	// Size of the image before and after the pass.
+	From, To image.Point
+
+	// Number of taps of one line, the sum over all its samples, and
+	// of the largest sample.
+	Taps, MaxTaps int
+
+	// Number of taps of the whole pass, each a multiply-add per channel.
+	Ops int
+
+	// If the passes are split into strips for the memory limit, the
+	// number of target rows of a strip.
+	StripRows int
+}
+
+// Estimates of a resize, see Plan.Explain. The byte counts are the
+// buffers of the resize itself, without the source and a given target.
+type Explanation struct {
+	// The passes in the order they run, two or four with a shrink stage.
+	Passes []Pass
+
+	// The 8-bit images use the fixed point pipeline.
+	FixedPoint bool
+
+	// Number of taps of all passes.
+	Ops int
+
+	// Bytes of the images between the passes and of the shrink stage.
+	TempBytes int
+
+	// Bytes of the filter tables and line buffers.
+	TableBytes, LineBytes int
+
+	// Bytes of the target created if none is given.
+	TargetBytes int
+
+	// All of the above.
+	PeakBytes int
+}
+
+// Describes the resize of src into dst with this plan: the order of
+// the passes, their taps and the memory needed. Either image may be nil,
+// a nil target is created like Resize does and a nil source is read via
+// At. Only the types of the images are of interest.
+//
+// The passes are split into strips as they would be for the memory limit.
+func (p *Plan) Explain(dst, src image.Image) Explanation {
+	if p.dstRect.Empty() {
+		return Explanation{}
+	}
+	newTarget := dst == nil
+	if newTarget {
+		dst = newTargetImage(src, image.Rectangle{})
+	}
+	e, _ := p.start(dst, src, nil, newTarget)
+	return e.explain()
+}
+
+// The bytes per pixel of the images newTargetImage creates.
+func pixelBytes(img image.Image) int {
+	switch img.(type) {
+	case *image.Gray:
+		return 1
+	case *image.Gray16:
+		return 2
+	}
+	return 8
+}
+
+func (e *execution) explain() Explanation {
+	var x Explanation
+	p := e.plan
+	if e.newTarget {
+		x.TargetBytes = pixelBytes(e.dst) * p.dstRect.Dx() * p.dstRect.Dy()
+	}
+
+	// The Scratch keeps one buffer of each kind, which grows to the
+	// largest pass using it.
+	var tmpBytes, lineBytes [4]int
+	stage := func(r resizePasses, dst image.Image, dstRect, srcRect image.Rectangle) {
+		// The intermediate image of the first pass is written to the
+		// target of the stage if it fits, see resizePasses.run.
+		_, inDst := dst.(*NRGBAF32)
+		from, to := srcRect.Size(), r.tmpBounds.Size()
+		if r.rows > 0 {
+			// The intermediate image as a whole.
+			to.Y = srcRect.Dy()
+		}
+		for i, af := range [...]axisFilter{r.firstFilter, r.secondFilter} {
+			axis, lines, ysize, dst_ysize := XAxis, from.Y, from.X, to.X
+			if (i == 0) != (r.first == xAxis) {
+				axis, lines, ysize, dst_ysize = YAxis, from.X, from.Y, to.Y
+			}
+			pass := Pass{Axis: axis, From: from, To: to, StripRows: r.rows,
+				Taps: af.ops, MaxTaps: af.maxTaps(), Ops: af.ops * lines}
+			x.TableBytes += af.tableBytes(r.fixed)
+			switch {
+			case r.rows > 0 && i == 0:
+				pass.Ops = af.ops * r.stripRows
+			case r.rows > 0:
+				pass.Ops = r.ops - x.Passes[len(x.Passes)-1].Ops
+				// The strip of the kernel and its lines.
+				ysize, dst_ysize = r.tmpBounds.Dy(), r.rows
+				x.TableBytes += (12 + 8*af.maxTaps()) * r.rows
+			}
+			x.Passes = append(x.Passes, pass)
+			switch {
+			case r.gray && r.first == yAxis:
+				// The ring of source rows and their indices, a line and
+				// a target line of one channel.
+				window := r.firstFilter.taps.window(srcRect.Dy())
+				lineBytes[2] = maxInt(lineBytes[2], 4*((window+1)*srcRect.Dx()+1+dstRect.Dx())+8*window)
+			case r.gray:
+				// A source and a target line of one channel.
+				lineBytes[2] = maxInt(lineBytes[2], 4*(from.X+1+to.X))
+			case r.fixed:
+				lineBytes[1] = maxInt(lineBytes[1], 16*lineBlock*(ysize+1+dst_ysize+1))
+			default:
+				lineBytes[0] = maxInt(lineBytes[0], 16*lineBlock*(ysize+1+dst_ysize+1))
+			}
+			from, to = to, dstRect.Size()
+		}
+		area := r.tmpBounds.Dx() * r.tmpBounds.Dy()
+		switch {
+		case r.gray:
+			tmpBytes[3] = maxInt(tmpBytes[3], 4*area)
+		case r.fixed:
+			tmpBytes[0] = maxInt(tmpBytes[0], 8*area)
+			x.FixedPoint = true
+		case inDst && r.tmpFits && r.rows == 0:
+		case r.half:
+			tmpBytes[1] = maxInt(tmpBytes[1], 8*area)
+		default:
+			tmpBytes[2] = maxInt(tmpBytes[2], 16*area)
+		}
+	}
+	if e.shrunk != nil {
+		stage(e.shrink, e.shrunk, p.shrinkRect, p.srcRect)
+		size := p.shrinkRect.Dx() * p.shrinkRect.Dy()
+		switch e.shrunk.(type) {
+		case *image.NRGBA:
+			x.TempBytes += 4 * size
+		case *nrgbaF16:
+			x.TempBytes += 8 * size
+		case *image.Gray16:
+			x.TempBytes += 2 * size
+		default:
+			x.TempBytes += 16 * size
+		}
+		stage(e.main, e.dst, p.dstRect, p.shrinkRect)
+	} else {
+		stage(e.main, e.dst, p.dstRect, p.srcRect)
+	}
+
+	x.Ops = e.ops()
+	for i := range tmpBytes {
+		x.TempBytes += tmpBytes[i]
+	}
+	x.LineBytes = lineBytes[0] + lineBytes[1] + lineBytes[2]
+	x.PeakBytes = x.TempBytes + x.TableBytes + x.LineBytes + x.TargetBytes
+	return x
+}
+
+func (x Explanation) String() string {
+	var b strings.Builder
+	for _, p := range x.Passes {
+		fmt.Fprintf(&b, "%v: %dx%d -> %dx%d, %d taps per line (max %d per sample), %d ops",
+			p.Axis, p.From.X, p.From.Y, p.To.X, p.To.Y, p.Taps, p.MaxTaps, p.Ops)
+		if p.StripRows > 0 {
+			fmt.Fprintf(&b, ", strips of %d rows", p.StripRows)
+		}
+		b.WriteString("\n")
+	}
+	pipeline := "float"
+	if x.FixedPoint {
+		pipeline = "fixed point"
+	}
+	fmt.Fprintf(&b, "%s, %d ops, %d bytes peak (temp %d, tables %d, lines %d, target %d)",
+		pipeline, x.Ops, x.PeakBytes, x.TempBytes, x.TableBytes, x.LineBytes, x.TargetBytes)
+	return b.String()
+}
+
+// The largest number of taps of a sample.
+func (af axisFilter) maxTaps() int {
+	n := 0
+	for _, k := range [...]*kernel{af.taps, af.alpha} {
+		if k == nil {
+			continue
+		}
+		m := 0
+		for _, s := range k.spans {
+			m = maxInt(m, int(s.n))
+		}
+		n += m
+	}
+	return n
+}
+
+// Bytes of the kernels, the fixed point taps included if fixed.
+func (af axisFilter) tableBytes(fixed bool) int {
+	n := 0
+	for _, k := range [...]*kernel{af.taps, af.alpha} {
+		if k == nil {
+			continue
+		}
+		n += k.tableBytes()
+		if fixed {
+			n += 8 * len(k.taps)
+		}
+	}
+	return n
+}
+
+// Bytes of the spans and taps of k.
+func (k *kernel) tableBytes() int {
+	return 12*len(k.spans) + 8*len(k.taps)
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Totals of the resizes run with a plan: by ResizeInto, or the plan of
+// a Job or a BatchResult.
+type Stats struct {
+	Runs     int64
+	Ops      int64
+	Duration time.Duration
+}
+
+// The totals of all finished resizes with this plan so far, canceled
+// ones aren't counted.
+func (p *Plan) Stats() Stats {
+	return Stats{
+		Runs:     atomic.LoadInt64(&p.runs),
+		Ops:      atomic.LoadInt64(&p.runOps),
+		Duration: time.Duration(atomic.LoadInt64(&p.runNanos)),
+	}
+}
+
+func (p *Plan) record(ops int, d time.Duration) {
+	atomic.AddInt64(&p.runs, 1)
+	atomic.AddInt64(&p.runOps, int64(ops))
+	atomic.AddInt64(&p.runNanos, int64(d))
+}
@@ -0,0 +1,75 @@
+package resample
+
+import (
+	"image"
+	"testing"
+)
+
+func TestExplainMatchesScratch(t *testing.T) {
+	// The estimated buffers are those a fresh Scratch grows to.
+	src := NewNRGBAF32(image.Rect(0, 0, 300, 200))
+	// Only the x axis is shrunk, the image between the passes of the
+	// shrink stage fits into its target.
+	wide := NewNRGBAF32(image.Rect(0, 0, 300, 50))
+	tests := []struct {
+		name string
+		dst  image.Image
+		src  *NRGBAF32
+		opt  Options
+	}{
+		{"enlarge", NewNRGBAF32(image.Rect(0, 0, 400, 300)), src, Options{}},
+		{"NRGBA64", image.NewNRGBA64(image.Rect(0, 0, 70, 50)), src, Options{}},
+		{"half", image.NewNRGBA64(image.Rect(0, 0, 70, 50)), src, Options{HalfFloatIntermediate: true}},
+		{"shrink", NewNRGBAF32(image.Rect(0, 0, 70, 50)), src, Options{Shrink: true}},
+		{"shrink NRGBA64", image.NewNRGBA64(image.Rect(0, 0, 70, 50)), src, Options{Shrink: true}},
+		{"shrink x", NewNRGBAF32(image.Rect(0, 0, 70, 50)), wide, Options{Shrink: true}},
+		{"shrink x NRGBA64", image.NewNRGBA64(image.Rect(0, 0, 70, 50)), wide, Options{Shrink: true}},
+	}
+	for _, tt := range tests {
+		src := tt.src
+		plan, err := Prepare(tt.dst.Bounds(), src.Rect, tt.opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x := plan.Explain(tt.dst, src)
+		s := new(Scratch)
+		if err := ResizeIntoWithScratch(tt.dst, src, plan, s); err != nil {
+			t.Fatal(err)
+		}
+		lines := 16 * cap(s.lines)
+		if x.LineBytes != lines {
+			t.Errorf("%s: LineBytes %d, the Scratch holds %d", tt.name, x.LineBytes, lines)
+		}
+		if tmp := s.bytes() - lines; x.TempBytes != tmp {
+			t.Errorf("%s: TempBytes %d, the Scratch holds %d", tt.name, x.TempBytes, tmp)
+		}
+	}
+}
+
+func TestStatsOfJobs(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 40, 30))
+	job, err := StartResize(nil, image.Rect(0, 0, 20, 15), src, src.Rect, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := job.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	x := job.Plan().Explain(nil, src)
+	if st := job.Plan().Stats(); st.Runs != 1 || st.Ops != int64(x.Ops) || st.Duration <= 0 {
+		t.Errorf("Stats() = %+v, want one run of %d ops", st, x.Ops)
+	}
+
+	b := NewBatchResizer(2).Start([]BatchTask{
+		{DstRect: image.Rect(0, 0, 10, 10), Src: src, SrcRect: src.Rect},
+		{DstRect: image.Rect(0, 0, 5, 5), Src: src, SrcRect: src.Rect},
+	})
+	for r := range b.Results() {
+		if r.Err != nil {
+			t.Fatal(r.Err)
+		}
+		if st := r.Plan.Stats(); st.Runs != 1 {
+			t.Errorf("task %d: Stats() = %+v, want one run", r.Index, st)
+		}
+	}
+}
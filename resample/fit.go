@@ -0,0 +1,150 @@
+package resample
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+// An Anchor selects which part of the source image is kept
+// when Fill has to crop it.
+type Anchor int
+
+const (
+	Center Anchor = iota
+	TopLeft
+	Top
+	TopRight
+	Left
+	Right
+	BottomLeft
+	Bottom
+	BottomRight
+)
+
+// Returns the largest size with the aspect ratio of size that fits
+// into maxW x maxH. Neither dimension is smaller than one pixel unless
+// size or the maximum is empty.
+func FitSize(size image.Point, maxW, maxH int) image.Point {
+	if size.X <= 0 || size.Y <= 0 || maxW <= 0 || maxH <= 0 {
+		return image.Point{}
+	}
+	scale := math.Min(float64(maxW)/float64(size.X), float64(maxH)/float64(size.Y))
+	return image.Point{
+		X: clampSize(int(math.Floor(float64(size.X)*scale+0.5)), maxW),
+		Y: clampSize(int(math.Floor(float64(size.Y)*scale+0.5)), maxH),
+	}
+}
+
+func clampSize(x, max int) int {
+	switch {
+	case x < 1:
+		return 1
+	case x > max:
+		return max
+	}
+	return x
+}
+
+// Returns the part of the rectangle r with the aspect ratio of w x h
+// which Fill uses as its source. The anchor chooses the part of r
+// which is kept.
+func FillRect(r image.Rectangle, w, h int, anchor Anchor) image.Rectangle {
+	size := r.Size()
+	if size.X <= 0 || size.Y <= 0 || w <= 0 || h <= 0 {
+		return image.Rectangle{Min: r.Min, Max: r.Min}
+	}
+	// The crop is the source sized rectangle fitted into
+	// w x h, scaled back by the cover factor.
+	scale := math.Max(float64(w)/float64(size.X), float64(h)/float64(size.Y))
+	crop := image.Point{
+		X: clampSize(int(math.Floor(float64(w)/scale+0.5)), size.X),
+		Y: clampSize(int(math.Floor(float64(h)/scale+0.5)), size.Y),
+	}
+
+	var offset image.Point
+	switch anchor {
+	case TopLeft, Left, BottomLeft:
+		offset.X = 0
+	case TopRight, Right, BottomRight:
+		offset.X = size.X - crop.X
+	default:
+		offset.X = (size.X - crop.X) / 2
+	}
+	switch anchor {
+	case TopLeft, Top, TopRight:
+		offset.Y = 0
+	case BottomLeft, Bottom, BottomRight:
+		offset.Y = size.Y - crop.Y
+	default:
+		offset.Y = (size.Y - crop.Y) / 2
+	}
+	min := r.Min.Add(offset)
+	return image.Rectangle{Min: min, Max: min.Add(crop)}
+}
+
+// Resize src to the largest size fitting into maxW x maxH while
+// keeping its aspect ratio. Smaller images are enlarged.
+func Fit(src image.Image, maxW, maxH int) (image.Image, error) {
+	if src == nil {
+		return nil, ErrSourceImageIsInvalid
+	}
+	if maxW < 0 || maxH < 0 {
+		return nil, ErrTargetSizeIsInvalid
+	}
+	size := FitSize(src.Bounds().Size(), maxW, maxH)
+	return Resize(nil, image.Rectangle{Max: size}, src, src.Bounds())
+}
+
+// Resize and crop src so that it covers exactly w x h while keeping
+// its aspect ratio. The anchor selects the part of src that is kept.
+//
+// Cropping and scaling are done in one pass.
+func Fill(src image.Image, w, h int, anchor Anchor) (image.Image, error) {
+	if src == nil {
+		return nil, ErrSourceImageIsInvalid
+	}
+	if w < 0 || h < 0 {
+		return nil, ErrTargetSizeIsInvalid
+	}
+	srcRect := FillRect(src.Bounds(), w, h, anchor)
+	return Resize(nil, image.Rect(0, 0, w, h), src, srcRect)
+}
+
+// Like Fit, but images already fitting into maxW x maxH are never
+// enlarged. They are returned as a copy of the same size, an
+// image.Gray or image.Gray16 for sources of these types, else an
+// image.NRGBA64.
+func Thumbnail(src image.Image, maxW, maxH int) (image.Image, error) {
+	if src == nil {
+		return nil, ErrSourceImageIsInvalid
+	}
+	if maxW < 0 || maxH < 0 {
+		return nil, ErrTargetSizeIsInvalid
+	}
+	size := src.Bounds().Size()
+	if size.X > maxW || size.Y > maxH {
+		size = FitSize(size, maxW, maxH)
+	}
+	return Resize(nil, image.Rectangle{Max: size}, src, src.Bounds())
+}
+
+// Resize src to fit into w x h like Fit and center it on a w x h image
+// filled with the background colour bg (letterboxing).
+func Pad(src image.Image, w, h int, bg color.Color) (image.Image, error) {
+	if src == nil {
+		return nil, ErrSourceImageIsInvalid
+	}
+	if w < 0 || h < 0 {
+		return nil, ErrTargetSizeIsInvalid
+	}
+	dst := image.NewNRGBA64(image.Rect(0, 0, w, h))
+	if bg != nil {
+		draw.Draw(dst, dst.Bounds(), &image.Uniform{bg}, image.Point{}, draw.Src)
+	}
+
+	size := FitSize(src.Bounds().Size(), w, h)
+	min := image.Pt((w-size.X)/2, (h-size.Y)/2)
+	return Resize(dst, image.Rectangle{Min: min, Max: min.Add(size)}, src, src.Bounds())
+}
@@ -0,0 +1,127 @@
+package resample
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestFitSize(t *testing.T) {
+	tests := []struct {
+		size       image.Point
+		maxW, maxH int
+		want       image.Point
+	}{
+		{image.Pt(400, 300), 200, 200, image.Pt(200, 150)},
+		{image.Pt(300, 400), 200, 200, image.Pt(150, 200)},
+		{image.Pt(100, 50), 400, 400, image.Pt(400, 200)},
+		{image.Pt(1000, 1), 10, 10, image.Pt(10, 1)},
+		{image.Pt(0, 10), 10, 10, image.Point{}},
+		{image.Pt(10, 10), 0, 10, image.Point{}},
+	}
+	for _, tt := range tests {
+		if got := FitSize(tt.size, tt.maxW, tt.maxH); got != tt.want {
+			t.Errorf("FitSize(%v, %d, %d) = %v, want %v", tt.size, tt.maxW, tt.maxH, got, tt.want)
+		}
+	}
+}
+
+func TestFillRect(t *testing.T) {
+	r := image.Rect(10, 20, 410, 320)
+	tests := []struct {
+		w, h   int
+		anchor Anchor
+		want   image.Rectangle
+	}{
+		{100, 100, Center, image.Rect(60, 20, 360, 320)},
+		{100, 100, Left, image.Rect(10, 20, 310, 320)},
+		{100, 100, BottomRight, image.Rect(110, 20, 410, 320)},
+		{400, 100, Top, image.Rect(10, 20, 410, 120)},
+		{400, 100, Bottom, image.Rect(10, 220, 410, 320)},
+		{400, 300, Center, r},
+	}
+	for _, tt := range tests {
+		if got := FillRect(r, tt.w, tt.h, tt.anchor); got != tt.want {
+			t.Errorf("FillRect(%v, %d, %d, %v) = %v, want %v", r, tt.w, tt.h, tt.anchor, got, tt.want)
+		}
+	}
+}
+
+func TestFitFillThumbnail(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 80, 40))
+	tests := []struct {
+		name string
+		f    func() (image.Image, error)
+		want image.Rectangle
+	}{
+		{"Fit", func() (image.Image, error) { return Fit(src, 20, 20) }, image.Rect(0, 0, 20, 10)},
+		{"Fit enlarges", func() (image.Image, error) { return Fit(src, 160, 160) }, image.Rect(0, 0, 160, 80)},
+		{"Fill", func() (image.Image, error) { return Fill(src, 30, 30, Center) }, image.Rect(0, 0, 30, 30)},
+		{"Thumbnail", func() (image.Image, error) { return Thumbnail(src, 20, 20) }, image.Rect(0, 0, 20, 10)},
+		{"Thumbnail keeps size", func() (image.Image, error) { return Thumbnail(src, 160, 160) }, image.Rect(0, 0, 80, 40)},
+	}
+	for _, tt := range tests {
+		img, err := tt.f()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if img.Bounds() != tt.want {
+			t.Errorf("%s: bounds %v, want %v", tt.name, img.Bounds(), tt.want)
+		}
+	}
+	if _, err := Fit(nil, 10, 10); err != ErrSourceImageIsInvalid {
+		t.Errorf("Fit(nil) = %v, want ErrSourceImageIsInvalid", err)
+	}
+	if _, err := Fill(src, -1, 10, Center); err != ErrTargetSizeIsInvalid {
+		t.Errorf("Fill(-1) = %v, want ErrTargetSizeIsInvalid", err)
+	}
+}
+
+func TestFillCrops(t *testing.T) {
+	// The left half is black, the right half white. Filling a square
+	// anchored right keeps only white pixels.
+	src := image.NewGray(image.Rect(0, 0, 80, 40))
+	for y := 0; y < 40; y++ {
+		for x := 40; x < 80; x++ {
+			src.SetGray(x, y, color.Gray{0xff})
+		}
+	}
+	img, err := Fill(src, 10, 10, Right)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 10; x++ {
+			if r, _, _, _ := img.At(x, y).RGBA(); r < 0xf000 {
+				t.Fatalf("pixel (%d, %d) = %#x, want white", x, y, r)
+			}
+		}
+	}
+}
+
+func TestPad(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 40, 20))
+	for i := range src.Pix {
+		src.Pix[i] = 0xff
+	}
+	bg := color.NRGBA{0, 0, 0xff, 0xff}
+	img, err := Pad(src, 40, 40, bg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 40, 40) {
+		t.Fatalf("bounds %v, want 40x40", img.Bounds())
+	}
+	// Letterboxed: the bars keep the background, the middle is the image.
+	for _, p := range []image.Point{{0, 0}, {39, 9}, {20, 30}, {39, 39}} {
+		if c := color.NRGBAModel.Convert(img.At(p.X, p.Y)); c != bg {
+			t.Errorf("bar pixel %v = %v, want %v", p, c, bg)
+		}
+	}
+	for _, p := range []image.Point{{0, 10}, {20, 20}, {39, 29}} {
+		if r, g, b, _ := img.At(p.X, p.Y).RGBA(); r < 0xf000 || g < 0xf000 || b < 0xf000 {
+			t.Errorf("image pixel %v = %v, want white", p, img.At(p.X, p.Y))
+		}
+	}
+}
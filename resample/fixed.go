@@ -0,0 +1,426 @@
+package resample
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Fixed point resampling of 8-bit images: image.RGBA, image.NRGBA and
+// image.YCbCr sources resampled into image.RGBA or image.NRGBA targets.
+// Targets of type image.YCbCr aren't supported, see ResizeYCbCr.
+//
+// Weights are int16 values with fixedWeightBits fractional bits and
+// all sums are accumulated in int32. Like the float32 path the colours
+// aren't premultiplied, those of image.RGBA are divided by alpha with
+// fixedTmpBits fractional bits when fetched and multiplied by it when
+// stored. The intermediate image keeps fixedTmpBits fractional bits
+// below the 8-bit value and isn't clamped, so the result matches the
+// float32 path within one code value.
+const (
+	fixedWeightBits = 14
+	fixedTmpBits    = 6
+	fixedOne        = 1 << fixedWeightBits
+)
+
+type fixedTap struct {
+	k int32
+	v int16
+}
+
+// The intermediate image of the fixed point pipeline. Each channel is
+// the 8-bit value scaled by 1<<fixedTmpBits.
+type fixedImage struct {
+	Pix    []int16
+	Stride int
+	Rect   image.Rectangle
+}
+
+func (p *fixedImage) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*4
+}
+
+func (p *fixedImage) ColorModel() color.Model { return color.NRGBAModel }
+
+func (p *fixedImage) Bounds() image.Rectangle { return p.Rect }
+
+func (p *fixedImage) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return color.NRGBA{}
+	}
+	i := p.PixOffset(x, y)
+	return color.NRGBA{clampToUint8(int32(p.Pix[i+0]) >> fixedTmpBits),
+		clampToUint8(int32(p.Pix[i+1]) >> fixedTmpBits),
+		clampToUint8(int32(p.Pix[i+2]) >> fixedTmpBits),
+		clampToUint8(int32(p.Pix[i+3]) >> fixedTmpBits)}
+}
+
+// Reports whether the fixed point pipeline can resample src into dst.
+//
+// Both images need 8-bit channels. The intermediate image holds the
+// 8-bit values with fixedTmpBits fractional bits in int16, which the
+// first pass mustn't exceed whatever the source. The second pass sums
+// them up in int32.
+func useFixed(dst, src image.Image, xFilter, yFilter axisFilter) bool {
+	if !fixedImages(dst, src) {
+		return false
+	}
+	for _, af := range [...]axisFilter{xFilter, yFilter} {
+		if af.alpha != nil || af.border != nil {
+			return false
+		}
+		af.taps.fixedTaps()
+		pos, neg := int64(af.taps.fixedPos), int64(af.taps.fixedNeg)
+		if 0xff<<fixedTmpBits*pos+fixedOne/2 > math.MaxInt16<<fixedWeightBits ||
+			0xff<<fixedTmpBits*neg+fixedOne/2 > math.MaxInt16<<fixedWeightBits ||
+			(math.MaxInt16+1)*(pos+neg)+1<<(fixedTmpBits+fixedWeightBits-1) > math.MaxInt32 {
+			return false
+		}
+	}
+	return true
+}
+
+// Reports whether both images have 8-bit channels.
+func fixedImages(dst, src image.Image) bool {
+	switch dst.(type) {
+	case *image.RGBA, *image.NRGBA:
+	default:
+		return false
+	}
+	switch src.(type) {
+	case *image.RGBA, *image.NRGBA, *image.YCbCr:
+		return true
+	}
+	return false
+}
+
+// The taps of k quantised by makeFixedTaps, made once.
+func (k *kernel) fixedTaps() []fixedTap {
+	k.fixedOnce.Do(func() { k.fixed, k.fixedPos, k.fixedNeg = makeFixedTaps(k) })
+	return k.fixed
+}
+
+// Quantise the weights of k, the result shares the spans of k. The
+// rounding error is added to the largest weight, so the taps of each
+// sample sum up to fixedOne exactly. Also returns the largest sums of
+// the positive and of the negative weights of a sample, as the
+// weights before they are truncated to int16 and with the rounding
+// error on top.
+func makeFixedTaps(k *kernel) ([]fixedTap, int, int) {
+	ff := make([]fixedTap, len(k.taps))
+	// Samples of the same phase share their taps.
+	done := make([]bool, len(k.taps))
+	maxPos, maxNeg := 0, 0
+	for _, span := range k.spans {
+		if span.n == 0 || done[span.start] {
+			continue
+		}
+		done[span.start] = true
+		taps := k.taps[span.start : span.start+span.n]
+		f := ff[span.start : span.start+span.n]
+		sum, pos, neg, largest := 0, 0, 0, 0
+		for j, kv := range taps {
+			v := int(math.Floor(float64(kv.v)*fixedOne + 0.5))
+			f[j] = fixedTap{kv.k, int16(v)}
+			sum += v
+			if v > 0 {
+				pos += v
+			} else {
+				neg -= v
+			}
+			if v > int(f[largest].v) {
+				largest = j
+			}
+		}
+		f[largest].v += int16(fixedOne - sum)
+		maxPos = maxInt(maxPos, pos+absInt(fixedOne-sum))
+		maxNeg = maxInt(maxNeg, neg+absInt(fixedOne-sum))
+	}
+	return ff, maxPos, maxNeg
+}
+
+func absInt(a int) int {
+	if a < 0 {
+		return -a
+	}
+	return a
+}
+
+func clampToUint8(x int32) uint8 {
+	if x > 0xff {
+		return 0xff
+	}
+	if x < 0 {
+		return 0
+	}
+	return uint8(x)
+}
+
+func clampToInt16(x int32) int16 {
+	if x > math.MaxInt16 {
+		return math.MaxInt16
+	}
+	if x < math.MinInt16 {
+		return math.MinInt16
+	}
+	return int16(x)
+}
+
+type i32RGBA struct {
+	R, G, B, A int32
+}
+
+// Fetch a line into column. Returns the number of fractional bits
+// of the fetched values.
+func fetchLineFixed(flipXY bool, column []i32RGBA, x int, src image.Image, origin image.Point) uint {
+	dy := origin.Y
+	dx := origin.X
+	var px, py int
+	switch src := src.(type) {
+	case *fixedImage:
+		pix := src.Pix
+		for y := range column {
+			if flipXY {
+				px, py = y+dx, x+dy
+			} else {
+				px, py = x+dx, y+dy
+			}
+			s := pix[src.PixOffset(px, py):]
+			s = s[:4:4]
+			column[y] = i32RGBA{int32(s[0]), int32(s[1]), int32(s[2]), int32(s[3])}
+		}
+		return fixedTmpBits
+	case *image.RGBA:
+		fetchLine8(flipXY, column, x, src.Pix, src.Stride, true, origin.Sub(src.Rect.Min))
+		return fixedTmpBits
+	case *image.NRGBA:
+		fetchLine8(flipXY, column, x, src.Pix, src.Stride, false, origin.Sub(src.Rect.Min))
+		return fixedTmpBits
+	case *image.YCbCr:
+		for y := range column {
+			if flipXY {
+				px, py = y+dx, x+dy
+			} else {
+				px, py = x+dx, y+dy
+			}
+			yi, ci := src.YOffset(px, py), src.COffset(px, py)
+			r, g, b := color.YCbCrToRGB(src.Y[yi], src.Cb[ci], src.Cr[ci])
+			column[y] = i32RGBA{int32(r), int32(g), int32(b), 0xff}
+		}
+	default:
+		panic("Unsupported source image. This is a BUG in go-resample.")
+	}
+	return 0
+}
+
+// Fetches the colours with fixedTmpBits fractional bits, divided by
+// alpha if premultiplied. The origin is relative to the first pixel of
+// pix.
+func fetchLine8(flipXY bool, column []i32RGBA, x int, pix []uint8, stride int,
+	premultiplied bool, origin image.Point) {
+	idx, step := (x+origin.Y)*stride+4*origin.X, 4
+	if !flipXY {
+		idx, step = origin.Y*stride+4*(x+origin.X), stride
+	}
+	for y := range column {
+		s := pix[idx : idx+4 : idx+4]
+		a := int32(s[3]) << fixedTmpBits
+		if !premultiplied {
+			column[y] = i32RGBA{int32(s[0]) << fixedTmpBits, int32(s[1]) << fixedTmpBits,
+				int32(s[2]) << fixedTmpBits, a}
+		} else {
+			column[y] = i32RGBA{unpremultiply(s[0], s[3]), unpremultiply(s[1], s[3]),
+				unpremultiply(s[2], s[3]), a}
+		}
+		idx += step
+	}
+}
+
+// 255<<(fixedTmpBits+16) divided by each alpha, rounded.
+var unpremultiplyTable = func() (t [256]uint32) {
+	for a := 1; a < 256; a++ {
+		t[a] = uint32((0xff<<(fixedTmpBits+16) + a/2) / a)
+	}
+	return
+}()
+
+// The colour c premultiplied by a without it, with fixedTmpBits
+// fractional bits. Colours exceeding alpha are clamped to it.
+func unpremultiply(c, a uint8) int32 {
+	if c > a {
+		c = a
+	}
+	return int32((uint32(c)*unpremultiplyTable[a] + 1<<15) >> 16)
+}
+
+// The colour c multiplied by a, both 8-bit values, rounded.
+func premultiply(c, a int32) uint8 {
+	t := c*a + 0x80
+	return uint8((t + t>>8) >> 8)
+}
+
+// Store a line of values with fixedTmpBits fractional bits in the
+// intermediate image, or with none in an 8-bit image.
+func putLineFixed(flipXY bool, column []i32RGBA, x int, dst image.Image, origin image.Point) {
+	dy := origin.Y
+	dx := origin.X
+	var px, py int
+	switch dst := dst.(type) {
+	case *fixedImage:
+		pix := dst.Pix
+		for y, c := range column {
+			if flipXY {
+				px, py = y+dx, x+dy
+			} else {
+				px, py = x+dx, y+dy
+			}
+			d := pix[dst.PixOffset(px, py):]
+			d = d[:4:4]
+			d[0] = clampToInt16(c.R)
+			d[1] = clampToInt16(c.G)
+			d[2] = clampToInt16(c.B)
+			d[3] = clampToInt16(c.A)
+		}
+	case *image.RGBA:
+		putLine8(flipXY, column, x, dst.Pix, dst.Stride, true, origin.Sub(dst.Rect.Min))
+	case *image.NRGBA:
+		putLine8(flipXY, column, x, dst.Pix, dst.Stride, false, origin.Sub(dst.Rect.Min))
+	default:
+		panic("Unsupported target image. This is a BUG in go-resample.")
+	}
+}
+
+// Stores the colours clamped, and multiplied by alpha if premultiplied.
+func putLine8(flipXY bool, column []i32RGBA, x int, pix []uint8, stride int,
+	premultiplied bool, origin image.Point) {
+	idx, step := (x+origin.Y)*stride+4*origin.X, 4
+	if !flipXY {
+		idx, step = origin.Y*stride+4*(x+origin.X), stride
+	}
+	for _, c := range column {
+		d := pix[idx : idx+4 : idx+4]
+		d[3] = clampToUint8(c.A)
+		if premultiplied {
+			a := int32(d[3])
+			d[0] = premultiply(int32(clampToUint8(c.R)), a)
+			d[1] = premultiply(int32(clampToUint8(c.G)), a)
+			d[2] = premultiply(int32(clampToUint8(c.B)), a)
+		} else {
+			d[0] = clampToUint8(c.R)
+			d[1] = clampToUint8(c.G)
+			d[2] = clampToUint8(c.B)
+		}
+		idx += step
+	}
+}
+
+// Like resampleAxis, with integer arithmetics only.
+func resampleAxisFixed(axis axisSwitch, keepAlive func(int) bool,
+	dst image.Image, dst_bbox image.Rectangle,
+	src image.Image, src_bbox image.Rectangle,
+	af axisFilter, s *Scratch) bool {
+	flip := axis != yAxis
+
+	ysize, xsize := src_bbox.Dy(), src_bbox.Dx()
+	dst_ysize := dst_bbox.Dy()
+	if flip {
+		xsize, ysize = ysize, xsize
+		dst_ysize = dst_bbox.Dx()
+	}
+
+	// Only the intermediate image keeps fractional bits.
+	var outBits uint
+	if _, ok := dst.(*fixedImage); ok {
+		outBits = fixedTmpBits
+	}
+
+	f := af.taps.fixedTaps()
+	src_lines, dst_lines, row := s.fixedLineBuffers(ysize, dst_ysize)
+
+	for x0 := 0; x0 < xsize; x0 += lineBlock {
+		var opCount int
+		n := xsize - x0
+		if n > lineBlock {
+			n = lineBlock
+		}
+		inBits := fetchLinesFixed(flip, src_lines[:n], x0, src, src_bbox.Min, row)
+		shift := inBits + fixedWeightBits - outBits
+		round := int32(1) << (shift - 1)
+		for i, src_column := range src_lines[:n] {
+			dst_column := dst_lines[i]
+			if af.taps.kind == replicateKernel {
+				// Only the fractional bits change, rounded like below.
+				conv := func(v int32) int32 {
+					return (v<<fixedWeightBits + round) >> shift
+				}
+				for y_i := range dst_column {
+					c := src_column[y_i/af.taps.factor]
+					dst_column[y_i] = i32RGBA{conv(c.R), conv(c.G), conv(c.B), conv(c.A)}
+				}
+				opCount += len(dst_column)
+				continue
+			}
+			for y_i := range dst_column {
+				var r, g, b, a int32
+				span := af.taps.spans[y_i]
+				taps := f[span.start : span.start+span.n]
+				column := src_column[span.base:]
+				for _, f_y := range taps {
+					src_c := &column[f_y.k]
+					v := int32(f_y.v)
+					r += v * src_c.R
+					g += v * src_c.G
+					b += v * src_c.B
+					a += v * src_c.A
+				}
+				dst_column[y_i] = i32RGBA{(r + round) >> shift, (g + round) >> shift,
+					(b + round) >> shift, (a + round) >> shift}
+				opCount += len(taps)
+			}
+		}
+		putLinesFixed(flip, dst_lines[:n], x0, dst, dst_bbox.Min, row)
+		if !keepAlive(opCount) {
+			return false
+		}
+	}
+	return true
+}
+
+// Like fetchLines, returns the fractional bits of the fetched values.
+func fetchLinesFixed(flipXY bool, lines [][]i32RGBA, x0 int,
+	src image.Image, origin image.Point, row []i32RGBA) uint {
+	var bits uint
+	if flipXY {
+		for i, line := range lines {
+			bits = fetchLineFixed(true, line, x0+i, src, origin)
+		}
+		return bits
+	}
+	row = row[:len(lines)]
+	origin.X += x0
+	for y := range lines[0] {
+		bits = fetchLineFixed(true, row, y, src, origin)
+		for i, c := range row {
+			lines[i][y] = c
+		}
+	}
+	return bits
+}
+
+func putLinesFixed(flipXY bool, lines [][]i32RGBA, x0 int,
+	dst image.Image, origin image.Point, row []i32RGBA) {
+	if flipXY {
+		for i, line := range lines {
+			putLineFixed(true, line, x0+i, dst, origin)
+		}
+		return
+	}
+	row = row[:len(lines)]
+	origin.X += x0
+	for y := range lines[0] {
+		for i := range row {
+			row[i] = lines[i][y]
+		}
+		putLineFixed(true, row, y, dst, origin)
+	}
+}
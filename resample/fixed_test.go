@@ -0,0 +1,155 @@
+package resample
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// An 8-bit image of random translucent pixels, premultiplied for RGBA.
+func random8(r image.Rectangle, premultiplied bool, rnd *rand.Rand) image.Image {
+	img := image.NewNRGBA(r)
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rnd.Intn(256))
+	}
+	if !premultiplied {
+		return img
+	}
+	rgba := image.NewRGBA(r)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			rgba.Set(x, y, img.At(x, y))
+		}
+	}
+	return rgba
+}
+
+// A new 8-bit image of the size.
+func new8(size image.Point, premultiplied bool) image.Image {
+	if premultiplied {
+		return image.NewRGBA(image.Rectangle{Max: size})
+	}
+	return image.NewNRGBA(image.Rectangle{Max: size})
+}
+
+func pix8(img image.Image) []uint8 {
+	if rgba, ok := img.(*image.RGBA); ok {
+		return rgba.Pix
+	}
+	return img.(*image.NRGBA).Pix
+}
+
+func TestFixedMatchesFloat(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	sizes := []image.Point{{5, 31}, {40, 7}, {23, 23}}
+	filters := map[string]Filter{"Box": Box, "Triangle": Triangle, "Lanczos3": Lanczos3}
+	for _, srcRGBA := range []bool{false, true} {
+		for _, dstRGBA := range []bool{false, true} {
+			src := random8(image.Rect(0, 0, 17, 13), srcRGBA, rnd)
+			for name, f := range filters {
+				for _, size := range sizes {
+					opt, err := Options{Filter: f}.normalize()
+					if err != nil {
+						t.Fatal(err)
+					}
+					plan := newPlan(image.Rectangle{Max: size}, src.Bounds(), opt)
+					fixed, float := new8(size, dstRGBA), new8(size, dstRGBA)
+
+					e, err := plan.start(fixed, src, new(Scratch), false)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !e.main.fixed {
+						t.Fatalf("RGBA %v into RGBA %v: fixed point pipeline not used", srcRGBA, dstRGBA)
+					}
+					e.run(keepGoing, ignorePhase)
+
+					e, _ = plan.start(float, src, new(Scratch), false)
+					e.main.fixed = false
+					e.run(keepGoing, ignorePhase)
+
+					a, b := pix8(fixed), pix8(float)
+					for i := range a {
+						if d := int(a[i]) - int(b[i]); d < -1 || d > 1 {
+							t.Fatalf("RGBA %v into RGBA %v, %v to %v: channel %d of pixel %d is %d, float32 gives %d",
+								srcRGBA, dstRGBA, name, size, i%4, i/4, a[i], b[i])
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// Resizes a uniform 4x4 image of c, of the type of src, into a 2x2 dst.
+func resizeUniform(t *testing.T, dst, src draw.Image, c color.Color) color.Color {
+	t.Helper()
+	draw.Draw(src, src.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+	if _, err := Resize(dst, dst.Bounds(), src, src.Bounds()); err != nil {
+		t.Fatal(err)
+	}
+	return dst.At(1, 1)
+}
+
+func TestAlphaRepresentation(t *testing.T) {
+	// Straight alpha stored premultiplied, and the other way round.
+	// NRGBA64 targets truncate the values.
+	r2, r4 := image.Rect(0, 0, 2, 2), image.Rect(0, 0, 4, 4)
+	if c := resizeUniform(t, image.NewRGBA(r2), image.NewNRGBA(r4), color.NRGBA{0xff, 0, 0, 0x80}); c != (color.RGBA{0x80, 0, 0, 0x80}) {
+		t.Errorf("NRGBA into RGBA: %v, want premultiplied red", c)
+	}
+	if c := resizeUniform(t, image.NewNRGBA(r2), image.NewRGBA(r4), color.RGBA{0x80, 0, 0, 0x80}); c != (color.NRGBA{0xff, 0, 0, 0x80}) {
+		t.Errorf("RGBA into NRGBA: %v, want straight red", c)
+	}
+	if c := resizeUniform(t, image.NewNRGBA64(r2), image.NewRGBA(r4), color.RGBA{0x80, 0, 0, 0x80}).(color.NRGBA64); c.R < 0xfffe || c.A < 0x807f {
+		t.Errorf("RGBA into NRGBA64: %v, want straight red", c)
+	}
+}
+
+func TestFixedOverflow(t *testing.T) {
+	// Weights below 2 whose positive ones sum up to more than 2, so
+	// the intermediate values of a source of 0 and 0xff overshoot the
+	// int16 range.
+	lobes := Filter{Apply: func(x float64) float64 {
+		switch x = math.Abs(x); {
+		case x < 0.5:
+			return 1
+		case x < 1.5:
+			return -0.4
+		case x < 2.5:
+			return 0.4
+		}
+		return 0
+	}, Support: 2.5}
+	src := image.NewNRGBA(image.Rect(0, 0, 17, 17))
+	rnd := rand.New(rand.NewSource(7))
+	for i := range src.Pix {
+		if rnd.Intn(2) == 0 || i%4 == 3 {
+			src.Pix[i] = 0xff
+		}
+	}
+	size := image.Pt(34, 34)
+	opt, err := Options{Filter: lobes}.normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := newPlan(image.Rectangle{Max: size}, src.Rect, opt)
+	got, want := new8(size, false), new8(size, false)
+	e, err := plan.start(got, src, new(Scratch), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.run(keepGoing, ignorePhase)
+	e, _ = plan.start(want, src, new(Scratch), false)
+	e.main.fixed = false
+	e.run(keepGoing, ignorePhase)
+	a, b := pix8(got), pix8(want)
+	for i := range a {
+		if d := int(a[i]) - int(b[i]); d < -1 || d > 1 {
+			t.Fatalf("channel %d of pixel %d is %d, float32 gives %d", i%4, i/4, a[i], b[i])
+		}
+	}
+}
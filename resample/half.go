@@ -0,0 +1,124 @@
+package resample
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// Convert to an IEEE 754 half precision float, rounding to nearest even.
+// Values too large for float16 become infinities.
+func f32ToF16(f float32) uint16 {
+	b := math.Float32bits(f)
+	sign := uint16(b>>16) & 0x8000
+	exp := int(b>>23&0xff) - 127 + 15
+	mant := b & 0x7fffff
+
+	switch {
+	case b&0x7fffffff > 0x7f800000:
+		// NaN
+		return sign | 0x7e00
+	case exp >= 0x1f:
+		return sign | 0x7c00
+	case exp <= 0:
+		// Subnormal or zero.
+		if exp < -10 {
+			return sign
+		}
+		mant |= 0x800000
+		shift := uint(14 - exp)
+		h := mant >> shift
+		rem := mant & (1<<shift - 1)
+		half := uint32(1) << (shift - 1)
+		if rem > half || (rem == half && h&1 != 0) {
+			h++
+		}
+		return sign | uint16(h)
+	}
+	// A carry of the rounding into the exponent is correct,
+	// even if it results in an infinity.
+	h := uint32(exp)<<10 | mant>>13
+	rem := mant & 0x1fff
+	if rem > 0x1000 || (rem == 0x1000 && h&1 != 0) {
+		h++
+	}
+	return sign | uint16(h)
+}
+
+func f16ToF32(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+
+	switch exp {
+	case 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	case 0:
+		// Subnormal or zero.
+		v := float32(mant) * (1.0 / (1 << 24))
+		if sign != 0 {
+			v = -v
+		}
+		return v
+	}
+	return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+}
+
+// Like NRGBAF32 but with float16 channels. Only used as the
+// intermediate image of the resampling to save memory.
+type nrgbaF16 struct {
+	Pix    []uint16
+	Stride int
+	Rect   image.Rectangle
+}
+
+func (p *nrgbaF16) ColorModel() color.Model { return NRGBAF32Model }
+
+func (p *nrgbaF16) Bounds() image.Rectangle { return p.Rect }
+
+func (p *nrgbaF16) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return NRGBAF32Color{}
+	}
+	i := p.PixOffset(x, y)
+	s := p.Pix[i : i+4 : i+4]
+	return NRGBAF32Color{f16ToF32(s[0]), f16ToF32(s[1]), f16ToF32(s[2]), f16ToF32(s[3])}
+}
+
+func (p *nrgbaF16) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*4
+}
+
+func fetchLineNRGBAF16(flipXY bool, column []f32RGBA, x int, src *nrgbaF16, origin image.Point) {
+	dy := origin.Y
+	dx := origin.X
+	pix := src.Pix
+	var idx int
+	for y := 0; y != len(column); y++ {
+		if flipXY {
+			idx = src.PixOffset(y+dx, x+dy)
+		} else {
+			idx = src.PixOffset(x+dx, y+dy)
+		}
+		column[y] = f32RGBA{f16ToF32(pix[idx+0]), f16ToF32(pix[idx+1]),
+			f16ToF32(pix[idx+2]), f16ToF32(pix[idx+3])}
+	}
+}
+
+func putLineNRGBAF16(flipXY bool, column []f32RGBA, x int, dst *nrgbaF16, origin image.Point) {
+	dy := origin.Y
+	dx := origin.X
+	pix := dst.Pix
+	var idx int
+	for y, dst_c := range column {
+		if flipXY {
+			idx = dst.PixOffset(y+dx, x+dy)
+		} else {
+			idx = dst.PixOffset(x+dx, y+dy)
+		}
+		pix[idx+0] = f32ToF16(dst_c.R)
+		pix[idx+1] = f32ToF16(dst_c.G)
+		pix[idx+2] = f32ToF16(dst_c.B)
+		pix[idx+3] = f32ToF16(dst_c.A)
+	}
+}
@@ -0,0 +1,93 @@
+package resample
+
+import (
+	"image"
+	"math"
+	"testing"
+)
+
+func TestF16RoundTrip(t *testing.T) {
+	// Every float16 value survives a round trip through float32.
+	for h := 0; h <= 0xffff; h++ {
+		f := f16ToF32(uint16(h))
+		if f != f {
+			if got := f32ToF16(f); got&0x7c00 != 0x7c00 || got&0x3ff == 0 {
+				t.Fatalf("NaN %#04x became %#04x", h, got)
+			}
+			continue
+		}
+		if got := f32ToF16(f); got != uint16(h) {
+			t.Fatalf("f32ToF16(f16ToF32(%#04x)) = %#04x", h, got)
+		}
+	}
+}
+
+func TestF32ToF16Rounding(t *testing.T) {
+	tests := []struct {
+		f    float32
+		want uint16
+	}{
+		{1, 0x3c00},
+		{-2, 0xc000},
+		// Halfway between 1 and the next float16 rounds to even.
+		{1 + 1.0/2048, 0x3c00},
+		{1 + 3.0/2048, 0x3c02},
+		{65504, 0x7bff},
+		{65520, 0x7c00},
+		{float32(math.Inf(-1)), 0xfc00},
+		// The smallest subnormal, and half of it rounding to zero.
+		{1.0 / (1 << 24), 0x0001},
+		{1.0 / (1 << 25), 0x0000},
+		{1.5 / (1 << 24), 0x0002},
+	}
+	for _, tt := range tests {
+		if got := f32ToF16(tt.f); got != tt.want {
+			t.Errorf("f32ToF16(%g) = %#04x, want %#04x", tt.f, got, tt.want)
+		}
+	}
+}
+
+// A hard edge along one axis of an image of values in [0, 1].
+func edgeF32(vertical bool) *NRGBAF32 {
+	img := NewNRGBAF32(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			v := float32(0.1)
+			if vertical && x >= 4 || !vertical && y >= 4 {
+				v = 0.9
+			}
+			img.SetNRGBAF32(x, y, NRGBAF32Color{v, v, v, 1})
+		}
+	}
+	return img
+}
+
+func TestIntermediateKeepsOvershoot(t *testing.T) {
+	// Lanczos3 overshoots the edge in one pass. Whichever pass that
+	// is, the overshoot survives the image between the passes.
+	opt := Options{Filter: Lanczos3, XBoundary: WrapFunc(Clamp), YBoundary: WrapFunc(Clamp)}
+	for _, vertical := range []bool{false, true} {
+		dst := resizeF32(t, edgeF32(vertical), image.Pt(40, 40), opt)
+		min, max := float32(1), float32(0)
+		for i := 0; i < len(dst.Pix); i += 4 {
+			min, max = -maxF32(-min, -dst.Pix[i]), maxF32(max, dst.Pix[i])
+		}
+		if min >= 0.1 || max <= 0.9 {
+			t.Errorf("vertical %v: range [%g, %g], want the overshoot kept", vertical, min, max)
+		}
+	}
+}
+
+func TestHalfFloatIntermediate(t *testing.T) {
+	opt := Options{Filter: Lanczos3, XBoundary: WrapFunc(Clamp), YBoundary: WrapFunc(Clamp)}
+	half := opt
+	half.HalfFloatIntermediate = true
+	for _, vertical := range []bool{false, true} {
+		src := edgeF32(vertical)
+		want, got := resizeF32(t, src, image.Pt(40, 40), opt), resizeF32(t, src, image.Pt(40, 40), half)
+		// 11 significant bits of values around 1.
+		if d := maxDiffF32(want, got); d > 1.0/1024 {
+			t.Errorf("vertical %v: half float intermediate differs by %g", vertical, d)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package resample
+
+import (
+	"errors"
+	"image"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Returned by Job.Wait if the job was canceled before it finished.
+var ErrCanceled = errors.New("Resize was canceled.")
+
+// A resize running in its own goroutine, see StartResize.
+//
+// Unlike the channels of ResizeToChannel nothing needs to be received
+// or sent: the goroutine ends on its own once the resize is finished or
+// canceled, even if the Job is abandoned. All methods may be called from
+// any goroutine, any number of times.
+type Job struct {
+	// Taps done and in total, accessed atomically. Kept first for the
+	// 64-bit alignment.
+	ops, total int64
+	// The current Phase, accessed atomically.
+	phase   int32
+	start   time.Time
+	quality Quality
+
+	cancel     chan struct{}
+	cancelOnce sync.Once
+	done       chan struct{}
+
+	// The image of Options.Preview once there is one.
+	preview atomic.Value
+	// The *Plan of the resize once it started.
+	plan atomic.Value
+
+	// Set before done is closed.
+	image   image.Image
+	err     error
+	elapsed time.Duration
+}
+
+// Starts resizing srcRect of src into dstRect of dst, see
+// ResizeToChannelWithOptions for the arguments. The errors of the
+// arguments are returned right away.
+func StartResize(dst image.Image, dstRect image.Rectangle,
+	src image.Image, srcRect image.Rectangle, opt Options) (*Job, error) {
+	opt, e, err := checkResize(dst, dstRect, src, srcRect, opt)
+	if err != nil {
+		return nil, err
+	}
+	j := &Job{start: time.Now(), cancel: make(chan struct{}), done: make(chan struct{})}
+	if e != nil {
+		j.quality = e.plan.quality
+	}
+	go func() {
+		defer close(j.done)
+		started := func(plan *Plan, total int) {
+			if plan != nil {
+				j.plan.Store(plan)
+			}
+			atomic.StoreInt64(&j.total, int64(total))
+		}
+		j.image, j.err = runResize(dst, dstRect, src, srcRect, opt, e, started, j.keepAlive, j.setPhase, j.setPreview)
+		j.elapsed = time.Since(j.start)
+		j.setPhase(PhaseDone)
+	}()
+	return j, nil
+}
+
+func (j *Job) setPhase(p Phase) {
+	atomic.StoreInt32(&j.phase, int32(p))
+}
+
+func (j *Job) setPreview(img image.Image) bool {
+	j.preview.Store(img)
+	return j.keepAlive(0)
+}
+
+func (j *Job) keepAlive(ops int) bool {
+	atomic.AddInt64(&j.ops, int64(ops))
+	select {
+	case <-j.cancel:
+		return false
+	default:
+		return true
+	}
+}
+
+// Stops the resize at the next block of lines. Has no effect once the
+// job is done.
+func (j *Job) Cancel() {
+	j.cancelOnce.Do(func() { close(j.cancel) })
+}
+
+// The plan of the resize once it started, nil before and for an empty
+// target rectangle. Once the job is done its Stats include the resize,
+// unless it was canceled.
+func (j *Job) Plan() *Plan {
+	plan, _ := j.plan.Load().(*Plan)
+	return plan
+}
+
+// Closed once the job is done, canceled or not.
+func (j *Job) Done() <-chan struct{} {
+	return j.done
+}
+
+// Waits until the job is done. Returns the target image, ErrCanceled if
+// the job was canceled first, or the error the resize failed with.
+func (j *Job) Wait() (image.Image, error) {
+	<-j.done
+	return j.image, j.err
+}
+
+// The progress so far. The step is done once the job is, with the
+// image or the error. Before, its image is the preview of
+// Options.Preview once there is one.
+func (j *Job) Progress() DetailedStep {
+	s := step{total: int(atomic.LoadInt64(&j.total)), done: int(atomic.LoadInt64(&j.ops)),
+		phase: Phase(atomic.LoadInt32(&j.phase)), quality: j.quality}
+	select {
+	case <-j.done:
+		s.image, s.err, s.elapsed = j.image, j.err, j.elapsed
+		s.phase = PhaseDone
+	default:
+		s.elapsed = time.Since(j.start)
+		if img, ok := j.preview.Load().(image.Image); ok {
+			s.image, s.preview = img, true
+		}
+	}
+	return s
+}
@@ -0,0 +1,80 @@
+package resample
+
+import (
+	"image"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// A resize slow enough to be canceled while running.
+func startSlow(t *testing.T) *Job {
+	t.Helper()
+	src := image.NewNRGBA64(image.Rect(0, 0, 500, 500))
+	job, err := StartResize(nil, image.Rect(0, 0, 2000, 2000), src, src.Rect, Options{Filter: Lanczos12})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return job
+}
+
+func TestJobWait(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 40, 30))
+	job, err := StartResize(nil, image.Rect(0, 0, 20, 15), src, src.Rect, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := job.Wait()
+	if err != nil || img == nil || img.Bounds() != image.Rect(0, 0, 20, 15) {
+		t.Fatalf("Wait() = %v, %v", img, err)
+	}
+	select {
+	case <-job.Done():
+	default:
+		t.Error("Done() not closed after Wait")
+	}
+	if st := job.Progress(); !st.Done() || st.Percent() != 100 || st.Image() != img {
+		t.Errorf("Progress() = %+v, want done", st)
+	}
+	// Canceling a finished job keeps its result.
+	job.Cancel()
+	job.Cancel()
+	if again, err := job.Wait(); again != img || err != nil {
+		t.Errorf("Wait() after Cancel = %v, %v", again, err)
+	}
+
+	if _, err := StartResize(nil, image.Rect(0, 0, 2, 2), nil, image.Rect(0, 0, 2, 2), Options{}); err != ErrSourceImageIsInvalid {
+		t.Errorf("StartResize(nil source) = %v", err)
+	}
+}
+
+func TestJobCancel(t *testing.T) {
+	job := startSlow(t)
+	job.Cancel()
+	job.Cancel()
+	if img, err := job.Wait(); err != ErrCanceled || img != nil {
+		t.Errorf("Wait() = %v, %v, want ErrCanceled", img, err)
+	}
+	if st := job.Progress(); !st.Done() || st.Image() != nil || st.Percent() == 100 {
+		t.Errorf("Progress() = %+v of a canceled job", st)
+	}
+}
+
+func TestJobDoesNotLeak(t *testing.T) {
+	before := runtime.NumGoroutine()
+	// Abandoned jobs finish on their own, canceled ones early.
+	for i := 0; i < 3; i++ {
+		src := image.NewNRGBA(image.Rect(0, 0, 40, 30))
+		if _, err := StartResize(nil, image.Rect(0, 0, 20, 15), src, src.Rect, Options{}); err != nil {
+			t.Fatal(err)
+		}
+		startSlow(t).Cancel()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines, %d before", runtime.NumGoroutine(), before)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
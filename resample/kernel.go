@@ -0,0 +1,274 @@
+package resample
+
+import (
+	"math"
+	"sync"
+)
+
+// A discrete filter, the taps of all destination samples of one axis.
+//
+// The taps are stored in one flat slice. Sample i uses the taps
+// taps[spans[i].start:][:spans[i].n], their indices are relative to
+// spans[i].base.
+//
+// If the scale is a simple ratio only a few distinct weight phases
+// exist. Samples of the same phase away from the boundaries then share
+// their taps, only the base differs. This polyphase bank saves memory
+// and setup time for big images.
+type kernel struct {
+	spans []kernelSpan
+	taps  []kvPair
+	// Total number of taps of all samples.
+	ops int
+
+	// Kernels of an integer scale factor which reduce to simple sums
+	// are recognised, see kernelKind.
+	kind   kernelKind
+	factor int
+
+	// The fixed point taps and the largest sums of their positive and
+	// of their negative weights of a sample, see fixedTaps.
+	fixedOnce          sync.Once
+	fixed              []fixedTap
+	fixedPos, fixedNeg int
+}
+
+type kernelKind int
+
+const (
+	generalKernel kernelKind = iota
+	// Sample i is the mean of the source samples [i*factor, (i+1)*factor).
+	boxDownKernel
+	// Sample i is the source sample i/factor.
+	replicateKernel
+)
+
+type kernelSpan struct {
+	base, start, n int32
+}
+
+// Returns the offset of the sample's indices and its taps.
+func (k *kernel) at(i int) (int, []kvPair) {
+	s := k.spans[i]
+	return int(s.base), k.taps[s.start : s.start+s.n]
+}
+
+// The position of the destination sample i in the source,
+// which is (a*i + b) / c.
+type mapping struct {
+	a, b, c int
+	// Scale from source to destination.
+	dst2src float64
+}
+
+func (m mapping) at(i int) float64 {
+	return float64(m.a*i+m.b) / float64(m.c)
+}
+
+// The mapping repeats itself every q samples, advancing p source samples.
+func (m mapping) period() (q, p int) {
+	g := gcd(m.a, m.c)
+	return m.c / g, m.a / g
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func newMapping(ndst, nsrc int) mapping {
+	// We want to map x=0, and x=maxX to map precicely to nx=0 and nx=nMaxX
+	// This explains the -1. This isn't obvious, as the scaling is now slightly
+	// different from the input - however this avoids artefacts at the X=maxX points
+	// Which are only vicible for certain input images...
+	// For example upscaling
+	// TESTIMAGES/ART/ART_R10_0120x0120/ART_R10_0120x0120_001.png
+	//
+	// With a single pixel on either side there is nothing to align, the
+	// plain size ratio is used instead and a single destination pixel
+	// is centered on the source.
+	switch {
+	case ndst > 1 && nsrc > 1:
+		return mapping{nsrc - 1, 0, ndst - 1, float64(ndst-1) / float64(nsrc-1)}
+	case ndst == 1:
+		return mapping{0, nsrc - 1, 2, 1 / float64(nsrc)}
+	}
+	return mapping{1, 0, ndst, float64(ndst)}
+}
+
+// Maps the pixel centres of the destination onto those of the source,
+// see Options.AlignCenters. If one size is a multiple of the other a
+// Box filter averages exactly factor source pixels when downsampling
+// (mipmaps) and replicates pixels when upsampling, and there are only
+// a few phases.
+func centeredMapping(ndst, nsrc int) mapping {
+	return mapping{2 * nsrc, nsrc - ndst, 2 * ndst, float64(ndst) / float64(nsrc)}
+}
+
+// Samples outside the source are mapped via the boundary b. If b has a
+// border colour rejected samples refer to the index nsrc instead, which
+// the line buffers reserve for that colour.
+//
+// Boundaries are assumed to map samples inside the source onto themselves.
+//
+// With centers the pixel centres are aligned instead of the corner
+// pixels, see centeredMapping.
+func makeKernel(f Filter, b Boundary, ndst, nsrc int, centers bool) *kernel {
+	if centers {
+		return makeMappedKernel(f, b, ndst, nsrc, centeredMapping(ndst, nsrc))
+	}
+	return makeMappedKernel(f, b, ndst, nsrc, newMapping(ndst, nsrc))
+}
+
+// Like makeKernel with the positions of the destination samples given
+// by m.
+func makeMappedKernel(f Filter, b Boundary, ndst, nsrc int, m mapping) *kernel {
+	_, hasBorder := b.(borderBoundary)
+	k := &kernel{spans: make([]kernelSpan, ndst)}
+
+	support := f.Support
+	fscale := 1.0
+	if m.dst2src < 1.0 {
+		// Downsampling.
+		support /= m.dst2src
+		fscale *= m.dst2src
+	}
+	nudge := 1e-8
+	window := func(src_x float64) (int, int) {
+		return int(math.Floor(src_x - support - nudge)), int(math.Ceil(src_x + support + nudge))
+	}
+
+	// Appends the taps of the sample at src_x and returns their number.
+	// Without a boundary the indices are relative to min.
+	appendTaps := func(src_x float64, min, max int, b Boundary) int32 {
+		var sum_v float32
+		start := len(k.taps)
+		for j := min; j <= max; j++ {
+			v := f.Apply(fscale*(float64(j)-src_x)) * fscale
+			idx := j - min
+			if b != nil {
+				idx = b.Wrap(j, 0, nsrc-1)
+				if hasBorder && (idx < 0 || idx >= nsrc) {
+					idx = nsrc
+				}
+				if idx < 0 || (idx >= nsrc && !hasBorder) {
+					continue
+				}
+			}
+			if v != 0 {
+				k.taps = append(k.taps, kvPair{int32(idx), float32(v)})
+				sum_v += float32(v)
+			}
+		}
+		// Rescaling so far hasn't been important for upscaling
+		// but it IS correct anyhow, so we keep the extra work.
+		// It SHOULD only kick in when due to rounding the
+		// pre-calculated filter has varying support.
+		rescale := float32(1.0) / sum_v
+		for j := start; j < len(k.taps); j++ {
+			k.taps[j].v *= rescale
+		}
+		return int32(len(k.taps) - start)
+	}
+
+	// A polyphase bank only pays off if each phase is used twice.
+	q, p := m.period()
+	var phases []kernelSpan
+	var widths []int
+	if 2*q <= ndst {
+		phases = make([]kernelSpan, q)
+		widths = make([]int, q)
+		for r := range phases {
+			src_x := m.at(r)
+			min, max := window(src_x)
+			start := int32(len(k.taps))
+			phases[r] = kernelSpan{base: int32(min), start: start, n: appendTaps(src_x, min, max, nil)}
+			widths[r] = max - min
+		}
+	}
+
+	for i := range k.spans {
+		if phases != nil {
+			phase := phases[i%q]
+			base := int(phase.base) + (i/q)*p
+			if base >= 0 && base+widths[i%q] <= nsrc-1 {
+				k.spans[i] = kernelSpan{int32(base), phase.start, phase.n}
+				k.ops += int(phase.n)
+				continue
+			}
+		}
+		src_x := m.at(i)
+		min, max := window(src_x)
+		start := int32(len(k.taps))
+		k.spans[i] = kernelSpan{0, start, appendTaps(src_x, min, max, b)}
+		k.ops += int(k.spans[i].n)
+	}
+	k.finish(ndst, nsrc)
+	return k
+}
+
+// Fill in the properties of the taps.
+func (k *kernel) finish(ndst, nsrc int) {
+	k.kind, k.factor = classifyKernel(k, ndst, nsrc)
+}
+
+// Recognise the kernels of a Box filter with an integer scale factor.
+func classifyKernel(k *kernel, ndst, nsrc int) (kernelKind, int) {
+	const tolerance = 1e-6
+	switch {
+	case nsrc%ndst == 0 && nsrc > ndst:
+		factor := nsrc / ndst
+		weight := 1 / float32(factor)
+		for i := range k.spans {
+			base, taps := k.at(i)
+			if len(taps) != factor {
+				return generalKernel, 0
+			}
+			for j, kv := range taps {
+				if base+int(kv.k) != i*factor+j || abs32(kv.v-weight) > tolerance {
+					return generalKernel, 0
+				}
+			}
+		}
+		return boxDownKernel, factor
+	case ndst%nsrc == 0 && ndst > nsrc:
+		factor := ndst / nsrc
+		for i := range k.spans {
+			base, taps := k.at(i)
+			if len(taps) != 1 || base+int(taps[0].k) != i/factor || abs32(taps[0].v-1) > tolerance {
+				return generalKernel, 0
+			}
+		}
+		return replicateKernel, factor
+	}
+	return generalKernel, 0
+}
+
+// Resample a line with a boxDownKernel or a replicateKernel.
+// Returns the number of taps.
+func resampleIntegerFactor(dst_column, src_column []f32RGBA, k *kernel) int {
+	factor := k.factor
+	switch k.kind {
+	case boxDownKernel:
+		scale := 1 / float32(factor)
+		for y_i := range dst_column {
+			var dst_c f32RGBA
+			for _, src_c := range src_column[y_i*factor : (y_i+1)*factor] {
+				dst_c.R += src_c.R
+				dst_c.G += src_c.G
+				dst_c.B += src_c.B
+				dst_c.A += src_c.A
+			}
+			dst_column[y_i] = f32RGBA{dst_c.R * scale, dst_c.G * scale, dst_c.B * scale, dst_c.A * scale}
+		}
+	case replicateKernel:
+		for y_i := range dst_column {
+			dst_column[y_i] = src_column[y_i/factor]
+		}
+	default:
+		panic("Not an integer factor kernel. This is a BUG in go-resample.")
+	}
+	return k.ops
+}
@@ -0,0 +1,178 @@
+package resample
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// The weights of sample i of makeKernel by source index, computed
+// directly from the filter.
+func directWeights(f Filter, b WrapFunc, ndst, nsrc, i int, centers bool) map[int]float64 {
+	m := newMapping(ndst, nsrc)
+	if centers {
+		m = centeredMapping(ndst, nsrc)
+	}
+	support, fscale := f.Support, 1.0
+	if m.dst2src < 1 {
+		support /= m.dst2src
+		fscale = m.dst2src
+	}
+	src_x := m.at(i)
+	w, sum := map[int]float64{}, 0.0
+	for j := int(math.Floor(src_x - support - 1e-8)); j <= int(math.Ceil(src_x+support+1e-8)); j++ {
+		v := f.Apply(fscale*(float64(j)-src_x)) * fscale
+		if idx := b(j, 0, nsrc-1); idx >= 0 && v != 0 {
+			w[idx] += v
+			sum += v
+		}
+	}
+	for idx := range w {
+		w[idx] /= sum
+	}
+	return w
+}
+
+func TestPolyphaseKernel(t *testing.T) {
+	tests := []struct{ ndst, nsrc int }{
+		{200, 300}, {300, 200}, {64, 16}, {16, 64}, {99, 100}, {7, 1000},
+	}
+	for _, tt := range tests {
+		for _, b := range []WrapFunc{Clamp, Reflect, Reject} {
+			for _, centers := range []bool{false, true} {
+				checkKernel(t, b, tt.ndst, tt.nsrc, centers)
+			}
+		}
+	}
+}
+
+func checkKernel(t *testing.T, b WrapFunc, ndst, nsrc int, centers bool) {
+	t.Helper()
+	k := makeKernel(Lanczos3, b, ndst, nsrc, centers)
+	ops := 0
+	for i := 0; i < ndst; i++ {
+		base, taps := k.at(i)
+		ops += len(taps)
+		got := map[int]float64{}
+		for _, kv := range taps {
+			got[base+int(kv.k)] += float64(kv.v)
+		}
+		want := directWeights(Lanczos3, b, ndst, nsrc, i, centers)
+		for idx := range got {
+			if _, ok := want[idx]; !ok {
+				want[idx] = 0
+			}
+		}
+		for idx, v := range want {
+			if math.Abs(got[idx]-v) > 1e-5 {
+				t.Fatalf("%d of %d, centers %v, sample %d: weight of %d is %g, want %g",
+					ndst, nsrc, centers, i, idx, got[idx], v)
+			}
+		}
+	}
+	if ops != k.ops {
+		t.Errorf("%d of %d: ops %d, want %d", ndst, nsrc, k.ops, ops)
+	}
+}
+
+func TestPolyphaseSharesTaps(t *testing.T) {
+	// The corners are aligned, 3000:2000 between them has 2 phases and
+	// the taps of the inner samples are shared.
+	k := makeKernel(Lanczos3, WrapFunc(Clamp), 2001, 3001, false)
+	if len(k.taps) >= k.ops/10 {
+		t.Errorf("%d taps stored for %d used, want them shared", len(k.taps), k.ops)
+	}
+	// 1499 is prime, so the period is too long for a bank.
+	k = makeKernel(Lanczos3, WrapFunc(Clamp), 1009, 1500, false)
+	if len(k.taps) != k.ops {
+		t.Errorf("%d taps stored for %d used, want no bank", len(k.taps), k.ops)
+	}
+	// Halving with aligned centres has a single phase.
+	k = makeKernel(Lanczos3, WrapFunc(Clamp), 1000, 2000, true)
+	if len(k.taps) > 12*12 {
+		t.Errorf("%d taps stored for halving, want a single phase and the boundaries", len(k.taps))
+	}
+}
+
+func TestIntegerFactorKernels(t *testing.T) {
+	tests := []struct {
+		f          Filter
+		ndst, nsrc int
+		centers    bool
+		kind       kernelKind
+	}{
+		{Box, 25, 100, true, boxDownKernel},
+		{Box, 100, 25, true, replicateKernel},
+		{Lanczos3, 50, 100, true, generalKernel},
+		// The corners are aligned by default.
+		{Box, 25, 100, false, generalKernel},
+	}
+	for _, tt := range tests {
+		if k := makeKernel(tt.f, WrapFunc(Clamp), tt.ndst, tt.nsrc, tt.centers); k.kind != tt.kind {
+			t.Errorf("%d of %d, centers %v: kind %d, want %d", tt.ndst, tt.nsrc, tt.centers, k.kind, tt.kind)
+		}
+	}
+}
+
+func TestIntegerFactorLines(t *testing.T) {
+	// The dedicated loops match the taps they replace.
+	rnd := rand.New(rand.NewSource(1))
+	for _, tt := range []struct {
+		f          Filter
+		b          Boundary
+		ndst, nsrc int
+	}{
+		{Box, WrapFunc(Clamp), 25, 100},
+		{Box, WrapFunc(Clamp), 100, 25},
+		{Box, Constant(color.Black), 100, 25},
+	} {
+		af := makeAxisFilter(tt.f, Filter{}, tt.b, tt.ndst, tt.nsrc, true)
+		if af.taps.kind == generalKernel {
+			t.Fatalf("%d of %d: no integer factor kernel", tt.ndst, tt.nsrc)
+		}
+		src := make([]f32RGBA, tt.nsrc+1)
+		for i := range src {
+			src[i] = f32RGBA{rnd.Float32(), rnd.Float32(), rnd.Float32(), rnd.Float32()}
+		}
+		if af.border != nil {
+			src[tt.nsrc] = *af.border
+		}
+		got := make([]f32RGBA, tt.ndst)
+		resampleLine(got, src, af)
+		for i := range got {
+			base, taps := af.taps.at(i)
+			if want := dotRGBAGeneric(src[base:], taps); !dotClose(want, got[i]) {
+				t.Fatalf("%d of %d, sample %d: %v, want %v", tt.ndst, tt.nsrc, i, got[i], want)
+			}
+		}
+	}
+}
+
+func TestAlignCenters(t *testing.T) {
+	// Halving a 2x2 checkerboard averages each block with Box.
+	src := image.NewNRGBA64(image.Rect(0, 0, 8, 8))
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			v := uint8(0)
+			if x/2%2 == y/2%2 {
+				v = 0xff
+			}
+			i := src.PixOffset(x, y)
+			src.Pix[i], src.Pix[i+1], src.Pix[i+6], src.Pix[i+7] = v, v, 0xff, 0xff
+		}
+	}
+	dst := resizeF32(t, src, image.Pt(4, 4), Options{Filter: Box, AlignCenters: true})
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			want := float32(0)
+			if x%2 == y%2 {
+				want = 1
+			}
+			if c := dst.NRGBAF32At(x, y); abs32(c.R-want) > 1e-6 {
+				t.Errorf("pixel (%d, %d) = %v, want %g", x, y, c, want)
+			}
+		}
+	}
+}
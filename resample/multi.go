@@ -0,0 +1,165 @@
+package resample
+
+import (
+	"image"
+	"time"
+)
+
+// Resamples srcRect of src into a new image of each of the sizes, for
+// example the widths of a responsive image, with bounds starting at
+// (0, 0). The images are of the types Resize creates.
+//
+// The source is read and converted only once: each block of its rows
+// is resampled along the x axis for all sizes before the next one is
+// read. Only the y axis passes are resampled per size. This saves the
+// most for sources without a fast path, which are read via At. The
+// images between the passes of all sizes exist at the same time.
+//
+// With Options.Shrink, or if these images exceed the MemoryLimit, the
+// sizes are resized one by one like StartResize does instead.
+// Options.Preview and Options.Deadline are ignored.
+func MultiResize(src image.Image, srcRect image.Rectangle,
+	sizes []image.Point, opt Options) ([]image.Image, error) {
+	opt.Preview, opt.Deadline = false, time.Time{}
+	limit := opt.MemoryLimit
+	opt.MemoryLimit = 0
+	// A single pixel checks the source rectangle even if all sizes
+	// are empty.
+	if err := validateImages(nil, image.Rect(0, 0, 1, 1), src, srcRect); err != nil {
+		return nil, err
+	}
+	for _, size := range sizes {
+		var err error
+		if opt, _, err = checkResize(nil, image.Rectangle{Max: size}, src, srcRect, opt); err != nil {
+			return nil, err
+		}
+	}
+	opt.MemoryLimit = limit
+	if opt.Shrink {
+		return resizeEach(src, srcRect, sizes, opt)
+	}
+
+	imgs := make([]image.Image, len(sizes))
+	var tmps []image.Image
+	var tmpRects []image.Rectangle
+	var xFilters, yFilters []axisFilter
+	var todo []int
+	// The source lines, and per size the intermediate image, the
+	// target, the tables and the lines, see resampleAxisMulti.
+	bytes := 16 * lineBlock * (srcRect.Dy() + 1)
+	tmpPixelBytes := 16
+	if opt.HalfFloatIntermediate {
+		tmpPixelBytes = 8
+	}
+	dstPixelBytes := pixelBytes(newTargetImage(src, image.Rectangle{}))
+	for _, size := range sizes {
+		if size.X == 0 || size.Y == 0 {
+			continue
+		}
+		xFilter, yFilter := opt.axisFilters(size, srcRect.Size())
+		bytes += tmpPixelBytes*size.X*srcRect.Dy() + dstPixelBytes*size.X*size.Y +
+			xFilter.tableBytes(false) + yFilter.tableBytes(false) + 16*lineBlock*size.Y
+		xFilters = append(xFilters, xFilter)
+		yFilters = append(yFilters, yFilter)
+	}
+	if limit > 0 && bytes > limit {
+		return resizeEach(src, srcRect, sizes, opt)
+	}
+	for i, size := range sizes {
+		imgs[i] = newTargetImage(src, image.Rectangle{Max: size})
+		if size.X == 0 || size.Y == 0 {
+			continue
+		}
+		// Like planPasses with the x axis first, the intermediate
+		// images have the full source height.
+		r := image.Rect(0, 0, size.X, srcRect.Dy())
+		if opt.HalfFloatIntermediate {
+			tmps = append(tmps, new(nrgbaF16).reuse(r))
+		} else {
+			tmps = append(tmps, NewNRGBAF32(r))
+		}
+		tmpRects = append(tmpRects, r)
+		todo = append(todo, i)
+	}
+	if len(todo) == 0 {
+		return imgs, nil
+	}
+
+	resampleAxisMulti(xAxis, tmps, tmpRects, src, srcRect, xFilters)
+	s := getScratch()
+	defer putScratch(s)
+	for j, i := range todo {
+		resampleAxis(yAxis, keepGoing, imgs[i], imgs[i].Bounds(), tmps[j], tmpRects[j], yFilters[j], s)
+		// Free for the collector as we go.
+		tmps[j] = nil
+	}
+	return imgs, nil
+}
+
+// The resizes of MultiResize one by one, each within the memory limit.
+func resizeEach(src image.Image, srcRect image.Rectangle,
+	sizes []image.Point, opt Options) ([]image.Image, error) {
+	imgs := make([]image.Image, len(sizes))
+	for i, size := range sizes {
+		dstRect := image.Rectangle{Max: size}
+		opt, e, err := checkResize(nil, dstRect, src, srcRect, opt)
+		if err != nil {
+			return nil, err
+		}
+		imgs[i], err = runResize(nil, dstRect, src, srcRect, opt, e,
+			func(*Plan, int) {}, keepGoing, ignorePhase, nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return imgs, nil
+}
+
+// Like resampleAxis for several targets at once, each with its own
+// filter. The source lines are fetched once for all of them.
+func resampleAxisMulti(axis axisSwitch, dsts []image.Image, dst_bboxes []image.Rectangle,
+	src image.Image, src_bbox image.Rectangle, afs []axisFilter) {
+	flip := axis != yAxis
+
+	xsize, ysize := src_bbox.Dx(), src_bbox.Dy()
+	if flip {
+		xsize, ysize = ysize, xsize
+	}
+
+	// The src lines have room for the border colour behind them,
+	// which is written per target.
+	var src_lines [lineBlock][]f32RGBA
+	buf := make([]f32RGBA, lineBlock*(ysize+1))
+	for i := range src_lines {
+		src_lines[i], buf = buf[:ysize:ysize+1], buf[ysize+1:]
+	}
+	dst_lines := make([][lineBlock][]f32RGBA, len(dsts))
+	for t, r := range dst_bboxes {
+		dst_ysize := r.Dy()
+		if flip {
+			dst_ysize = r.Dx()
+		}
+		buf := make([]f32RGBA, lineBlock*dst_ysize)
+		for i := range dst_lines[t] {
+			dst_lines[t][i], buf = buf[:dst_ysize], buf[dst_ysize:]
+		}
+	}
+	row := make([]f32RGBA, lineBlock)
+
+	for x0 := 0; x0 < xsize; x0 += lineBlock {
+		n := xsize - x0
+		if n > lineBlock {
+			n = lineBlock
+		}
+		fetchLines(flip, src_lines[:n], ysize, x0, src, src_bbox.Min, row)
+		for t, af := range afs {
+			for i, src_column := range src_lines[:n] {
+				if af.border != nil {
+					src_column = append(src_column, *af.border)
+				}
+				resampleLine(dst_lines[t][i], src_column, af)
+			}
+			putLines(flip, dst_lines[t][:n], x0, dsts[t], dst_bboxes[t].Min, row)
+		}
+	}
+}
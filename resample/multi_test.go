@@ -0,0 +1,115 @@
+package resample
+
+import (
+	"image"
+	"math/rand"
+	"testing"
+)
+
+func TestMultiResize(t *testing.T) {
+	src := random8(image.Rect(0, 0, 90, 70), false, rand.New(rand.NewSource(3)))
+	sizes := []image.Point{{30, 20}, {0, 5}, {120, 100}, {45, 70}}
+	tests := []struct {
+		name string
+		opt  Options
+		// Of the 16-bit channels, the pass order may differ.
+		tolerance int
+	}{
+		{"default", Options{}, 2},
+		{"half", Options{Filter: CatmullRom, HalfFloatIntermediate: true}, 0x200},
+		{"shrink", Options{Filter: Triangle, Shrink: true}, 2},
+		// Too small for the images of all sizes, not for each.
+		{"limit", Options{MemoryLimit: 200000}, 2},
+	}
+	for _, test := range tests {
+		imgs, err := MultiResize(src, src.Bounds(), sizes, test.opt)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		for i, size := range sizes {
+			job, err := StartResize(nil, image.Rectangle{Max: size}, src, src.Bounds(), test.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := job.Wait()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := imgs[i].(*image.NRGBA64)
+			if !ok || got.Rect != want.Bounds() {
+				t.Fatalf("%s: %T of %v, want %v", test.name, imgs[i], imgs[i].Bounds(), want.Bounds())
+			}
+			for j := 0; j < len(got.Pix); j += 2 {
+				a := int(got.Pix[j])<<8 | int(got.Pix[j+1])
+				b := int(want.(*image.NRGBA64).Pix[j])<<8 | int(want.(*image.NRGBA64).Pix[j+1])
+				if d := a - b; d < -test.tolerance || d > test.tolerance {
+					t.Errorf("%s, %v: channel %d of pixel %d is %#x, Resize gives %#x",
+						test.name, size, j/2%4, j/8, a, b)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestMultiResizeErrors(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 50, 50))
+	tests := []struct {
+		src     image.Image
+		srcRect image.Rectangle
+		sizes   []image.Point
+		opt     Options
+		want    error
+	}{
+		{nil, src.Rect, []image.Point{{5, 5}}, Options{}, ErrSourceImageIsInvalid},
+		{src, image.Rect(40, 40, 60, 60), nil, Options{}, ErrSourceImageIsInvalid},
+		{src, src.Rect, []image.Point{{5, 5}, {-1, 5}}, Options{}, ErrTargetSizeIsInvalid},
+		{src, src.Rect, []image.Point{{5, 5}}, Options{Mode: Mode(-1)}, ErrInvalidMode},
+	}
+	for i, test := range tests {
+		if _, err := MultiResize(test.src, test.srcRect, test.sizes, test.opt); err != test.want {
+			t.Errorf("%d: %v, want %v", i, err, test.want)
+		}
+	}
+	if _, err := MultiResize(src, src.Rect, []image.Point{{40, 40}}, Options{MemoryLimit: 100}); err == nil {
+		t.Errorf("no error for a memory limit of 100 bytes")
+	} else if _, ok := err.(*MemoryLimitError); !ok {
+		t.Errorf("%v, want a *MemoryLimitError", err)
+	}
+}
+
+func TestMultiResizeGray(t *testing.T) {
+	rnd := rand.New(rand.NewSource(5))
+	src := image.NewGray(image.Rect(0, 0, 90, 70))
+	for i := range src.Pix {
+		src.Pix[i] = uint8(rnd.Intn(256))
+	}
+	sizes := []image.Point{{30, 20}, {120, 100}}
+	// The type mustn't depend on the way the sizes are resized.
+	for _, opt := range []Options{{}, {Filter: Triangle, Shrink: true}, {MemoryLimit: 100000}} {
+		imgs, err := MultiResize(src, src.Rect, sizes, opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, size := range sizes {
+			job, err := StartResize(nil, image.Rectangle{Max: size}, src, src.Rect, opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := job.Wait()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := imgs[i].(*image.Gray)
+			if !ok || got.Rect != want.Bounds() {
+				t.Fatalf("%+v: %T of %v, want a Gray of %v", opt, imgs[i], imgs[i].Bounds(), want.Bounds())
+			}
+			for j, v := range got.Pix {
+				if d := int(v) - int(want.(*image.Gray).Pix[j]); d < -1 || d > 1 {
+					t.Errorf("%+v, %v: pixel %d is %d, Resize gives %d", opt, size, j, v, want.(*image.Gray).Pix[j])
+					break
+				}
+			}
+		}
+	}
+}
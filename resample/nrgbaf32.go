@@ -0,0 +1,132 @@
+package resample
+
+import (
+	"image"
+	"image/color"
+)
+
+// A non-alpha-premultiplied colour with float32 channels.
+//
+// The nominal range of each channel is [0,1], but values outside of
+// it are kept, for example negative filter lobes or HDR highlights.
+type NRGBAF32Color struct {
+	R, G, B, A float32
+}
+
+func unitToUint16(x float32) uint32 {
+	return uint32(clampF32ToUint16(f32_to_uint16*x + 0.5))
+}
+
+// Implements color.Color. Channels are clamped to [0,1].
+func (c NRGBAF32Color) RGBA() (r, g, b, a uint32) {
+	r, g, b, a = unitToUint16(c.R), unitToUint16(c.G), unitToUint16(c.B), unitToUint16(c.A)
+	r = r * a / 0xffff
+	g = g * a / 0xffff
+	b = b * a / 0xffff
+	return
+}
+
+// The color.Model of NRGBAF32Color.
+var NRGBAF32Model color.Model = color.ModelFunc(nrgbaF32Model)
+
+func nrgbaF32Model(c color.Color) color.Color {
+	if c, ok := c.(NRGBAF32Color); ok {
+		return c
+	}
+	n := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+	return NRGBAF32Color{
+		R: uint16_to_f32 * float32(n.R),
+		G: uint16_to_f32 * float32(n.G),
+		B: uint16_to_f32 * float32(n.B),
+		A: uint16_to_f32 * float32(n.A),
+	}
+}
+
+// An in-memory image of NRGBAF32Color values.
+//
+// The resampler reads and writes it without any conversion or clamping,
+// so it is suited for scientific and HDR pipelines.
+type NRGBAF32 struct {
+	// Pix holds the image's pixels, in R, G, B, A order. The pixel at
+	// (x, y) starts at Pix[(y-Rect.Min.Y)*Stride + (x-Rect.Min.X)*4].
+	Pix []float32
+	// Stride is the Pix stride (in float32s) between vertically adjacent pixels.
+	Stride int
+	// Rect is the image's bounds.
+	Rect image.Rectangle
+}
+
+// Returns a new NRGBAF32 with the given bounds.
+func NewNRGBAF32(r image.Rectangle) *NRGBAF32 {
+	w, h := r.Dx(), r.Dy()
+	return &NRGBAF32{Pix: make([]float32, 4*w*h), Stride: 4 * w, Rect: r}
+}
+
+func (p *NRGBAF32) ColorModel() color.Model { return NRGBAF32Model }
+
+func (p *NRGBAF32) Bounds() image.Rectangle { return p.Rect }
+
+func (p *NRGBAF32) At(x, y int) color.Color {
+	return p.NRGBAF32At(x, y)
+}
+
+func (p *NRGBAF32) NRGBAF32At(x, y int) NRGBAF32Color {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return NRGBAF32Color{}
+	}
+	i := p.PixOffset(x, y)
+	s := p.Pix[i : i+4 : i+4]
+	return NRGBAF32Color{s[0], s[1], s[2], s[3]}
+}
+
+// Returns the index of the first element of Pix that corresponds to
+// the pixel at (x, y).
+func (p *NRGBAF32) PixOffset(x, y int) int {
+	return (y-p.Rect.Min.Y)*p.Stride + (x-p.Rect.Min.X)*4
+}
+
+func (p *NRGBAF32) Set(x, y int, c color.Color) {
+	p.SetNRGBAF32(x, y, nrgbaF32Model(c).(NRGBAF32Color))
+}
+
+func (p *NRGBAF32) SetNRGBAF32(x, y int, c NRGBAF32Color) {
+	if !(image.Point{x, y}.In(p.Rect)) {
+		return
+	}
+	i := p.PixOffset(x, y)
+	s := p.Pix[i : i+4 : i+4]
+	s[0], s[1], s[2], s[3] = c.R, c.G, c.B, c.A
+}
+
+// Returns an image representing the portion of the image p visible
+// through r. The returned value shares pixels with the original image.
+func (p *NRGBAF32) SubImage(r image.Rectangle) image.Image {
+	r = r.Intersect(p.Rect)
+	if r.Empty() {
+		return &NRGBAF32{}
+	}
+	i := p.PixOffset(r.Min.X, r.Min.Y)
+	return &NRGBAF32{
+		Pix:    p.Pix[i:],
+		Stride: p.Stride,
+		Rect:   r,
+	}
+}
+
+// Reports whether the image is fully opaque.
+func (p *NRGBAF32) Opaque() bool {
+	if p.Rect.Empty() {
+		return true
+	}
+	i0, i1 := 3, p.Rect.Dx()*4
+	for y := p.Rect.Min.Y; y < p.Rect.Max.Y; y++ {
+		for i := i0; i < i1; i += 4 {
+			if p.Pix[i] < 1 {
+				return false
+			}
+		}
+		i0 += p.Stride
+		i1 += p.Stride
+	}
+	return true
+}
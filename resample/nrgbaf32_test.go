@@ -0,0 +1,55 @@
+package resample
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+var _ draw.Image = (*NRGBAF32)(nil)
+
+func TestNRGBAF32SetAt(t *testing.T) {
+	img := NewNRGBAF32(image.Rect(-2, -2, 3, 3))
+	img.SetNRGBAF32(1, -1, NRGBAF32Color{2.5, -0.5, 0.25, 1})
+	if c := img.NRGBAF32At(1, -1); c != (NRGBAF32Color{2.5, -0.5, 0.25, 1}) {
+		t.Errorf("NRGBAF32At = %v, want the values set", c)
+	}
+	// Converted colours are not premultiplied.
+	img.Set(0, 0, color.NRGBA{0xff, 0, 0, 0x80})
+	if c := img.NRGBAF32At(0, 0); c.R != 1 || c.A < 0.5 || c.A > 0.51 {
+		t.Errorf("NRGBAF32At = %v, want opaque red at half alpha", c)
+	}
+	// color.Color clamps to the nominal range.
+	if r, g, _, a := img.At(1, -1).RGBA(); r != 0xffff || g != 0 || a != 0xffff {
+		t.Errorf("RGBA() = %#x %#x %#x, want clamped values", r, g, a)
+	}
+	sub := img.SubImage(image.Rect(1, -1, 2, 0)).(*NRGBAF32)
+	if c := sub.NRGBAF32At(1, -1); c.R != 2.5 {
+		t.Errorf("SubImage doesn't share the pixels: %v", c)
+	}
+	if img.Opaque() {
+		t.Error("Opaque() with translucent pixels")
+	}
+}
+
+func TestNRGBAF32KeepsRange(t *testing.T) {
+	// A hard edge between HDR values, Lanczos3 overshoots on both sides.
+	src := NewNRGBAF32(image.Rect(0, 0, 8, 1))
+	for x := 0; x < 8; x++ {
+		v := float32(-1)
+		if x >= 4 {
+			v = 4
+		}
+		src.SetNRGBAF32(x, 0, NRGBAF32Color{v, v, v, 1})
+	}
+	dst := resizeF32(t, src, image.Pt(32, 1), Options{XBoundary: WrapFunc(Clamp), YBoundary: WrapFunc(Clamp)})
+	min, max := float32(0), float32(0)
+	for x := 0; x < 32; x++ {
+		c := dst.NRGBAF32At(x, 0)
+		min, max = -maxF32(-min, -c.R), maxF32(max, c.R)
+	}
+	if min >= -1 || max <= 4 {
+		t.Errorf("range [%g, %g], want the overshoot beyond [-1, 4] kept", min, max)
+	}
+}
@@ -0,0 +1,377 @@
+package resample
+
+import (
+	"image"
+	"time"
+)
+
+// A resize of srcRect into dstRect prepared by Prepare, mostly the
+// filter tables. A Plan doesn't change once prepared, so any number of
+// resizes may use it at the same time.
+type Plan struct {
+	// Totals of the runs, see Stats. Kept first for the 64-bit
+	// alignment of the atomic operations.
+	runs, runOps, runNanos int64
+
+	dstRect, srcRect image.Rectangle
+	half             bool
+	memoryLimit      int
+	quality          Quality
+
+	// The filters of the main stage, which resamples the source or the
+	// image of the shrink stage.
+	xFilter, yFilter axisFilter
+
+	// The shrink stage of Options.Shrink, if any.
+	shrink     bool
+	shrinkRect image.Rectangle
+	xBox, yBox axisFilter
+}
+
+// Prepares resizing srcRect of a source image into dstRect of a target
+// image, see Options.
+//
+// Building the filter tables is a good part of the work for small
+// images, a Plan used by ResizeInto saves that for repeated resizes of
+// the same sizes.
+func Prepare(dstRect, srcRect image.Rectangle, opt Options) (*Plan, error) {
+	opt, err := opt.normalize()
+	if err != nil {
+		return nil, err
+	}
+	if dstRect.Dx() < 0 || dstRect.Dy() < 0 {
+		return nil, ErrTargetSizeIsInvalid
+	}
+	if !dstRect.Empty() && srcRect.Empty() {
+		return nil, ErrSourceImageIsInvalid
+	}
+	if err := checkTables(dstRect, srcRect, opt); err != nil {
+		return nil, err
+	}
+	return newPlan(dstRect, srcRect, opt), nil
+}
+
+// The quality level the plan was made at, see Options.Deadline. Plans
+// of Prepare have the requested one.
+func (p *Plan) Quality() Quality {
+	return p.quality
+}
+
+// Like Prepare for validated options and rectangles.
+func newPlan(dstRect, srcRect image.Rectangle, opt Options) *Plan {
+	p := &Plan{dstRect: dstRect, srcRect: srcRect,
+		half: opt.HalfFloatIntermediate, memoryLimit: opt.MemoryLimit}
+	if dstRect.Empty() {
+		return p
+	}
+	// With Shrink the source is first box filtered into an
+	// intermediate image of a size close to the target.
+	mainSize := srcRect.Size()
+	if opt.Shrink && opt.Mode == FilterMode {
+		if size := shrinkSize(dstRect.Size(), srcRect.Size()); size != srcRect.Size() {
+			p.shrink = true
+			p.shrinkRect = image.Rectangle{Max: size}
+			p.xBox = makeAxisFilter(Box, Filter{}, WrapFunc(Reject), size.X, srcRect.Dx(), true)
+			p.yBox = makeAxisFilter(Box, Filter{}, WrapFunc(Reject), size.Y, srcRect.Dy(), true)
+			mainSize = size
+		}
+	}
+	p.xFilter, p.yFilter = opt.axisFilters(dstRect.Size(), mainSize)
+	return p
+}
+
+// Resizes the source rectangle of plan in src into its target rectangle
+// in dst and returns once done.
+//
+// The buffers needed on the way are recycled via a sync.Pool, so
+// repeated resizes don't allocate on the heap once the pool is warm.
+// That holds for the images with fast paths, see the package
+// documentation, other source images are read via At. Checking a
+// memory limit and resampling in strips allocates a little.
+func ResizeInto(dst, src image.Image, plan *Plan) error {
+	s := getScratch()
+	err := ResizeIntoWithScratch(dst, src, plan, s)
+	putScratch(s)
+	return err
+}
+
+// Like ResizeInto, with the caller's buffers instead of pooled ones.
+func ResizeIntoWithScratch(dst, src image.Image, plan *Plan, s *Scratch) error {
+	if plan == nil || s == nil {
+		return ErrLogicError
+	}
+	if dst == nil {
+		return ErrTargetImageIsInvalid
+	}
+	if err := validateImages(dst, plan.dstRect, src, plan.srcRect); err != nil {
+		return err
+	}
+	if plan.dstRect.Empty() {
+		return nil
+	}
+	e, err := plan.start(dst, src, s, false)
+	if err != nil {
+		return err
+	}
+	t := time.Now()
+	e.run(keepGoing, ignorePhase)
+	d := time.Since(t)
+	plan.record(e.ops(), d)
+	costs.observe(&e, d)
+	return nil
+}
+
+func keepGoing(int) bool { return true }
+
+// The passes of a plan for a pair of images.
+type execution struct {
+	plan     *Plan
+	dst, src image.Image
+	s        *Scratch
+	// The target is created for the resize, which counts towards
+	// the memory limit.
+	newTarget bool
+
+	// The image of the shrink stage, nil without one.
+	shrunk       image.Image
+	shrink, main resizePasses
+}
+
+// Plans the passes for the images. Without a Scratch nothing is
+// allocated, which is enough for estimates.
+//
+// Passes exceeding the memory limit are split into strips, see tile.
+// Returns a *MemoryLimitError if that isn't enough.
+func (p *Plan) start(dst, src image.Image, s *Scratch, newTarget bool) (execution, error) {
+	e := execution{plan: p, dst: dst, src: src, s: s, newTarget: newTarget}
+	mainSrc, mainSrcRect := src, p.srcRect
+	if p.shrink {
+		// Allocated once the limit is checked.
+		e.shrunk = p.shrunkImage(dst, src, nil)
+		e.shrink = planPasses(e.shrunk, p.shrinkRect, src, p.srcRect, p.xBox, p.yBox, p.half)
+		mainSrc, mainSrcRect = e.shrunk, p.shrinkRect
+	}
+	e.main = planPasses(dst, p.dstRect, mainSrc, mainSrcRect, p.xFilter, p.yFilter, p.half)
+	if p.memoryLimit > 0 && e.explain().PeakBytes > p.memoryLimit {
+		if err := e.split(mainSrcRect); err != nil {
+			return e, err
+		}
+	}
+	e.use(dst, s)
+	return e, nil
+}
+
+// Gives e the target and the buffers to run with, e is started without
+// a Scratch for estimates. For an estimate of a new target dst is an
+// empty image of its type, see newTargetImage.
+func (e *execution) use(dst image.Image, s *Scratch) {
+	e.dst, e.s = dst, s
+	if s != nil && e.shrunk != nil {
+		e.shrunk = e.plan.shrunkImage(dst, e.src, s)
+	}
+}
+
+// The image of the shrink stage, without pixels for a nil s.
+func (p *Plan) shrunkImage(dst, src image.Image, s *Scratch) image.Image {
+	var none *Scratch
+	shrunk := none.shrunk(dst, p.shrinkRect, p.half)
+	if useFixed(shrunk, src, p.xBox, p.yBox) || isGray(shrunk) && isGray(src) {
+		return s.shrunk(dst, p.shrinkRect, p.half)
+	}
+	return s.shrunkFloat(p.shrinkRect, p.half)
+}
+
+// Split the passes of e into strips to stay within the memory limit.
+func (e *execution) split(mainSrcRect image.Rectangle) error {
+	p := e.plan
+
+	// Find the largest strips that fit, the shrink stage first as
+	// its image exists during the main stage as well.
+	if e.shrunk != nil {
+		e.fit(&e.shrink, p.xBox, p.yBox, p.shrinkRect, p.srcRect)
+	}
+	e.fit(&e.main, p.xFilter, p.yFilter, p.dstRect, mainSrcRect)
+	if needed := e.explain().PeakBytes; needed > p.memoryLimit {
+		return &MemoryLimitError{Limit: p.memoryLimit, Needed: needed}
+	}
+	return nil
+}
+
+// Split the passes r of e into the largest strips which keep e within
+// the memory limit, single rows if none do. r is left as it is if it
+// fits already.
+func (e *execution) fit(r *resizePasses, xFilter, yFilter axisFilter, dstRect, srcRect image.Rectangle) {
+	limit := e.plan.memoryLimit
+	whole := *r
+	if e.explain().PeakBytes <= limit {
+		return
+	}
+	peak := func(rows int) int {
+		*r = whole
+		r.tile(rows, xFilter, yFilter, dstRect, srcRect)
+		return e.explain().PeakBytes
+	}
+	// The peak grows about linearly with the rows of a strip: the
+	// rows of the intermediate image under them, their taps and their
+	// lines. So the rows follow from the peak of one and two rows.
+	one := peak(1)
+	if one > limit || dstRect.Dy() == 1 {
+		return
+	}
+	perRow := maxInt(peak(2)-one, 1)
+	rows := 1 + (limit-one)/perRow
+	if rows > dstRect.Dy() {
+		rows = dstRect.Dy()
+	}
+	// The windows of the strips vary by a row or two of the
+	// intermediate image.
+	for rows > 1 {
+		over := peak(rows) - limit
+		if over <= 0 {
+			return
+		}
+		rows -= maxInt(1, (over+perRow-1)/perRow)
+	}
+	peak(maxInt(rows, 1))
+}
+
+// Number of taps of all passes.
+func (e *execution) ops() int {
+	if e.shrunk != nil {
+		return e.shrink.ops + e.main.ops
+	}
+	return e.main.ops
+}
+
+// Reports the phase of each pass before it starts. Returns false if
+// keepAlive canceled the resize.
+func (e *execution) run(keepAlive func(int) bool, phase func(Phase)) bool {
+	p := e.plan
+	if e.shrunk == nil {
+		return e.main.run(keepAlive, phase, mainPhases, e.dst, p.dstRect, e.src, p.srcRect, e.s)
+	}
+	return e.shrink.run(keepAlive, phase, shrinkPhases, e.shrunk, p.shrinkRect, e.src, p.srcRect, e.s) &&
+		e.main.run(keepAlive, phase, mainPhases, e.dst, p.dstRect, e.shrunk, p.shrinkRect, e.s)
+}
+
+// The two passes of a resize, one per axis.
+type resizePasses struct {
+	first, second             axisSwitch
+	firstFilter, secondFilter axisFilter
+	// Bounds of the image between the passes.
+	tmpBounds image.Rectangle
+	// The intermediate image may only be written to dst if it fits
+	// into dstRect. Otherwise we'd overwrite pixels of dst that
+	// aren't part of the resampled area.
+	tmpFits bool
+	fixed   bool
+	half    bool
+	// Number of taps of both passes.
+	ops int
+
+	// Number of target rows of a strip, zero if not split. Then the
+	// first pass is the x axis and resamples stripRows source rows in
+	// total, tmpBounds is the largest strip of the intermediate image.
+	rows, stripRows int
+
+	// Both images are gray, they are resampled as one channel by
+	// resamplePlane.
+	gray bool
+}
+
+func planPasses(dst image.Image, dstRect image.Rectangle,
+	src image.Image, srcRect image.Rectangle,
+	xFilter, yFilter axisFilter, half bool) resizePasses {
+	xy_ops := yFilter.ops*srcRect.Dx() + xFilter.ops*dstRect.Dy()
+	yx_ops := xFilter.ops*srcRect.Dy() + yFilter.ops*dstRect.Dx()
+
+	// The order is chosen by the taps plus the memory traffic of
+	// the intermediate image, which differs in size between them.
+	fixed := useFixed(dst, src, xFilter, yFilter)
+	gray := isGray(dst) && isGray(src)
+	tmpPixelBytes := 16
+	switch {
+	case gray:
+		tmpPixelBytes = 4
+	case fixed || half:
+		tmpPixelBytes = 8
+	}
+	xy_cost := xy_ops + trafficCost(srcRect.Dx()*dstRect.Dy()*tmpPixelBytes)
+	yx_cost := yx_ops + trafficCost(dstRect.Dx()*srcRect.Dy()*tmpPixelBytes)
+
+	p := resizePasses{
+		first: xAxis, second: yAxis,
+		firstFilter: xFilter, secondFilter: yFilter,
+		tmpBounds: image.Rect(0, 0, dstRect.Dx(), srcRect.Dy()),
+		fixed:     fixed,
+		half:      half,
+		ops:       yx_ops,
+		gray:      gray,
+	}
+	p.tmpFits = p.tmpBounds.Dy() <= dstRect.Dy()
+	if xy_cost < yx_cost {
+		p.first, p.second = yAxis, xAxis
+		p.firstFilter, p.secondFilter = yFilter, xFilter
+		p.tmpBounds = image.Rect(0, 0, srcRect.Dx(), dstRect.Dy())
+		p.tmpFits = p.tmpBounds.Dx() <= dstRect.Dx()
+		p.ops = xy_ops
+	}
+	return p
+}
+
+func (p resizePasses) run(keepAlive func(int) bool, phase func(Phase), phases [2]Phase,
+	dst image.Image, dstRect image.Rectangle,
+	src image.Image, srcRect image.Rectangle, s *Scratch) bool {
+	if p.rows > 0 {
+		return p.runStrips(keepAlive, phase, phases, dst, dstRect, src, srcRect, s)
+	}
+	if p.gray {
+		srcPlane := grayPlane(src, srcRect)
+		f := grayFilter(p.firstFilter, p.secondFilter, srcPlane)
+		if p.first == yAxis {
+			f = grayFilter(p.secondFilter, p.firstFilter, srcPlane)
+			f.yFirst = true
+		}
+		return resamplePlane(grayPlane(dst, dstRect), srcPlane, f, keepAlive, phase, phases, s)
+	}
+	if p.fixed {
+		tmp := s.fixedIntermediate(p.tmpBounds)
+		phase(phases[0])
+		if !resampleAxisFixed(p.first, keepAlive, tmp, p.tmpBounds, src, srcRect, p.firstFilter, s) {
+			return false
+		}
+		phase(phases[1])
+		return resampleAxisFixed(p.second, keepAlive, dst, dstRect, tmp, p.tmpBounds, p.secondFilter, s)
+	}
+
+	// The intermediate image is only written to dst if it keeps
+	// float32 values too. Otherwise we'd lose precision.
+	var tmp image.Image
+	tmpBounds := p.tmpBounds
+	if _, ok := dst.(*NRGBAF32); ok && p.tmpFits {
+		tmp = dst
+		tmpBounds = tmpBounds.Add(dstRect.Min)
+	} else {
+		tmp = s.intermediate(tmpBounds, p.half)
+	}
+	phase(phases[0])
+	if !resampleAxis(p.first, keepAlive, tmp, tmpBounds, src, srcRect, p.firstFilter, s) {
+		return false
+	}
+	phase(phases[1])
+	return resampleAxis(p.second, keepAlive, dst, dstRect, tmp, tmpBounds, p.secondFilter, s)
+}
+
+// The size of the box filtered image of Options.Shrink. Each axis is
+// shrunk by the largest integer factor which keeps it at least as big
+// as the target.
+func shrinkSize(dst, src image.Point) image.Point {
+	shrink := func(ndst, nsrc int) int {
+		factor := nsrc / ndst
+		if factor < 2 {
+			return nsrc
+		}
+		return (nsrc + factor - 1) / factor
+	}
+	return image.Pt(shrink(dst.X, src.X), shrink(dst.Y, src.Y))
+}
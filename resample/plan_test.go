@@ -0,0 +1,93 @@
+package resample
+
+import (
+	"image"
+	"testing"
+)
+
+func TestPassOrder(t *testing.T) {
+	opt, err := Options{}.normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		src, dst image.Point
+		first    axisSwitch
+	}{
+		// Shrinking the long axis first keeps the intermediate small.
+		{"wide", image.Pt(2000, 50), image.Pt(100, 40), xAxis},
+		{"tall", image.Pt(50, 2000), image.Pt(40, 100), yAxis},
+		// Enlarging the short axis last does the same.
+		{"wide enlarged", image.Pt(200, 10), image.Pt(220, 200), xAxis},
+		{"tall enlarged", image.Pt(10, 200), image.Pt(200, 220), yAxis},
+	}
+	for _, tt := range tests {
+		src, dst := image.NewNRGBA64(image.Rectangle{Max: tt.src}), image.NewNRGBA64(image.Rectangle{Max: tt.dst})
+		xFilter, yFilter := opt.axisFilters(tt.dst, tt.src)
+		p := planPasses(dst, dst.Rect, src, src.Rect, xFilter, yFilter, false)
+		if p.first != tt.first {
+			t.Errorf("%s: first pass %v, want %v", tt.name, p.first, tt.first)
+		}
+
+		// The order taken is the cheaper one of both.
+		xy := yFilter.ops*tt.src.X + xFilter.ops*tt.dst.Y + trafficCost(16*tt.src.X*tt.dst.Y)
+		yx := xFilter.ops*tt.src.Y + yFilter.ops*tt.dst.X + trafficCost(16*tt.dst.X*tt.src.Y)
+		cost := yx
+		if p.first == yAxis {
+			cost = xy
+		}
+		if cost > xy || cost > yx {
+			t.Errorf("%s: cost %d of the order taken, y first %d, x first %d", tt.name, cost, xy, yx)
+		}
+	}
+}
+
+func TestShrinkSize(t *testing.T) {
+	tests := []struct{ dst, src, want image.Point }{
+		{image.Pt(200, 100), image.Pt(12000, 6000), image.Pt(200, 100)},
+		{image.Pt(200, 100), image.Pt(12100, 150), image.Pt(202, 150)},
+		{image.Pt(10, 10), image.Pt(39, 19), image.Pt(13, 19)},
+		{image.Pt(10, 10), image.Pt(5, 10), image.Pt(5, 10)},
+	}
+	for _, tt := range tests {
+		if got := shrinkSize(tt.dst, tt.src); got != tt.want {
+			t.Errorf("shrinkSize(%v, %v) = %v, want %v", tt.dst, tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestShrink(t *testing.T) {
+	// A smooth gradient hardly changes with the box prefilter, which
+	// aligns the pixel centres.
+	src := NewNRGBAF32(image.Rect(0, 0, 900, 600))
+	for y := 0; y < 600; y++ {
+		for x := 0; x < 900; x++ {
+			src.SetNRGBAF32(x, y, NRGBAF32Color{float32(x) / 900, float32(y) / 600, 0.5, 1})
+		}
+	}
+	size := image.Pt(30, 20)
+	opt := Options{XBoundary: WrapFunc(Clamp), YBoundary: WrapFunc(Clamp), AlignCenters: true}
+	shrink := opt
+	shrink.Shrink = true
+	if d := maxDiffF32(resizeF32(t, src, size, opt), resizeF32(t, src, size, shrink)); d > 0.01 {
+		t.Errorf("shrunk resize differs by %g", d)
+	}
+
+	full, err := Prepare(image.Rectangle{Max: size}, src.Rect, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	shrunk, err := Prepare(image.Rectangle{Max: size}, src.Rect, shrink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !shrunk.shrink || shrunk.shrinkRect.Size() != size {
+		t.Fatalf("shrink stage to %v, want %v", shrunk.shrinkRect.Size(), size)
+	}
+	fe, _ := full.start(src, src, nil, false)
+	se, _ := shrunk.start(src, src, nil, false)
+	if 4*se.ops() > fe.ops() {
+		t.Errorf("%d taps with Shrink, %d without", se.ops(), fe.ops())
+	}
+}
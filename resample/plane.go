@@ -0,0 +1,273 @@
+package resample
+
+import (
+	"image"
+)
+
+// Resampling of single channel images, the planes of an image.YCbCr
+// and gray images. The samples are resampled as float32 values in the
+// units of the source, the x axis first unless the planeFilter says
+// otherwise. The y axis pass adds whole rows, so both passes walk
+// memory along rows.
+
+// A single channel image.
+type plane struct {
+	pix    []uint8
+	stride int
+	// Size in samples.
+	w, h int
+	// 16-bit big endian samples like image.Gray16, else 8-bit.
+	wide bool
+}
+
+func (p plane) max() float32 {
+	if p.wide {
+		return 0xffff
+	}
+	return 0xff
+}
+
+func (p plane) loadRow(line []float32, y int) {
+	row := p.pix[y*p.stride:]
+	if p.wide {
+		for i := range line {
+			line[i] = float32(uint16(row[2*i])<<8 | uint16(row[2*i+1]))
+		}
+		return
+	}
+	for i, v := range row[:len(line)] {
+		line[i] = float32(v)
+	}
+}
+
+// Stores the row y, its samples scaled by scale.
+func (p plane) storeRow(line []float32, y int, scale float32) {
+	row := p.pix[y*p.stride:]
+	if p.wide {
+		for i, v := range line {
+			s := clampF32ToUint16(scale*v + 0.5)
+			row[2*i], row[2*i+1] = uint8(s>>8), uint8(s)
+		}
+		return
+	}
+	for i, v := range line {
+		row[i] = clampF32ToUint8(scale*v + 0.5)
+	}
+}
+
+// The plane of a gray image within r.
+func grayPlane(img image.Image, r image.Rectangle) plane {
+	switch img := img.(type) {
+	case *image.Gray:
+		return plane{pix: img.Pix[img.PixOffset(r.Min.X, r.Min.Y):], stride: img.Stride, w: r.Dx(), h: r.Dy()}
+	case *image.Gray16:
+		return plane{pix: img.Pix[img.PixOffset(r.Min.X, r.Min.Y):], stride: img.Stride, w: r.Dx(), h: r.Dy(), wide: true}
+	}
+	panic("Not a gray image. This is a BUG in go-resample.")
+}
+
+func isGray(img image.Image) bool {
+	switch img.(type) {
+	case *image.Gray, *image.Gray16:
+		return true
+	}
+	return false
+}
+
+// The luma of a colour of the pipeline, with the weights of
+// color.GrayModel.
+func luma(c f32RGBA) float32 {
+	return 0.299*c.R + 0.587*c.G + 0.114*c.B
+}
+
+// The taps of both axes of a plane and the value of the border the
+// taps refer to by the index nsrc, nil if the boundary has none.
+type planeFilter struct {
+	x, y             *kernel
+	xBorder, yBorder *float32
+	// Resample the y axis first, see planPasses.
+	yFirst bool
+}
+
+// The filter of a gray plane, its border in the units of src.
+func grayFilter(xFilter, yFilter axisFilter, src plane) planeFilter {
+	border := func(af axisFilter) *float32 {
+		if af.border == nil {
+			return nil
+		}
+		v := src.max() * luma(*af.border)
+		return &v
+	}
+	return planeFilter{x: xFilter.taps, y: yFilter.taps, xBorder: border(xFilter), yBorder: border(yFilter)}
+}
+
+// Resamples src into dst. Calls keepAlive with the taps done after
+// each block of lines, returns false if it canceled the resize.
+func resamplePlane(dst, src plane, f planeFilter, keepAlive func(int) bool, phase func(Phase), phases [2]Phase, s *Scratch) bool {
+	if f.yFirst {
+		return resamplePlaneYX(dst, src, f, keepAlive, phase, phases, s)
+	}
+	tmp, line, acc := s.planeBuffers(dst.w*src.h, src.w+1, dst.w)
+	if f.xBorder != nil {
+		line[src.w] = *f.xBorder
+	}
+	phase(phases[0])
+	for y0 := 0; y0 < src.h; y0 += lineBlock {
+		n := src.h - y0
+		if n > lineBlock {
+			n = lineBlock
+		}
+		for y := y0; y < y0+n; y++ {
+			src.loadRow(line[:src.w], y)
+			resamplePlaneLine(tmp[y*dst.w:][:dst.w], line, f.x)
+		}
+		if !keepAlive(f.x.ops * n) {
+			return false
+		}
+	}
+
+	phase(phases[1])
+	scale := dst.max() / src.max()
+	for y0 := 0; y0 < dst.h; y0 += lineBlock {
+		n := dst.h - y0
+		if n > lineBlock {
+			n = lineBlock
+		}
+		var ops int
+		for y := y0; y < y0+n; y++ {
+			ops += resamplePlaneRows(acc, tmp, src.h, f.y, f.yBorder, y)
+			dst.storeRow(acc, y, scale)
+		}
+		if !keepAlive(ops * dst.w) {
+			return false
+		}
+	}
+	return true
+}
+
+// Like resamplePlane with the y axis first, for reductions mostly
+// along it. The source rows under the taps of a target row are kept in
+// a ring of window rows, so each is loaded about once.
+func resamplePlaneYX(dst, src plane, f planeFilter, keepAlive func(int) bool, phase func(Phase), phases [2]Phase, s *Scratch) bool {
+	window := f.y.window(src.h)
+	tmp, rows, acc := s.planeBuffers(src.w*dst.h, (window+1)*src.w+1, dst.w)
+	loaded := s.planeRowBuffer(window)
+	line := rows[window*src.w:]
+	if f.xBorder != nil {
+		line[src.w] = *f.xBorder
+	}
+	phase(phases[0])
+	for y0 := 0; y0 < dst.h; y0 += lineBlock {
+		n := dst.h - y0
+		if n > lineBlock {
+			n = lineBlock
+		}
+		var ops int
+		for y := y0; y < y0+n; y++ {
+			acc := tmp[y*src.w:][:src.w]
+			for i := range acc {
+				acc[i] = 0
+			}
+			base, taps := f.y.at(y)
+			for _, kv := range taps {
+				j := base + int(kv.k)
+				if j == src.h {
+					b := kv.v * *f.yBorder
+					for i := range acc {
+						acc[i] += b
+					}
+					continue
+				}
+				slot := j % window
+				row := rows[slot*src.w:][:src.w]
+				if loaded[slot] != j {
+					src.loadRow(row, j)
+					loaded[slot] = j
+				}
+				v := kv.v
+				for i, s := range row {
+					acc[i] += v * s
+				}
+			}
+			ops += len(taps)
+		}
+		if !keepAlive(ops * src.w) {
+			return false
+		}
+	}
+
+	phase(phases[1])
+	scale := dst.max() / src.max()
+	for y0 := 0; y0 < dst.h; y0 += lineBlock {
+		n := dst.h - y0
+		if n > lineBlock {
+			n = lineBlock
+		}
+		for y := y0; y < y0+n; y++ {
+			copy(line, tmp[y*src.w:][:src.w])
+			resamplePlaneLine(acc, line, f.x)
+			dst.storeRow(acc, y, scale)
+		}
+		if !keepAlive(f.x.ops * n) {
+			return false
+		}
+	}
+	return true
+}
+
+// The number of source samples from the first to the last a
+// destination sample of k reads at most, nsrc for the border aside.
+func (k *kernel) window(nsrc int) int {
+	w := 1
+	for i := range k.spans {
+		base, taps := k.at(i)
+		lo, hi := nsrc, -1
+		for _, kv := range taps {
+			if j := base + int(kv.k); j < nsrc {
+				if j < lo {
+					lo = j
+				}
+				hi = maxInt(hi, j)
+			}
+		}
+		w = maxInt(w, hi-lo+1)
+	}
+	return w
+}
+
+// Resample a line, the border value behind src if k refers to it.
+func resamplePlaneLine(dst, src []float32, k *kernel) {
+	for i := range dst {
+		base, taps := k.at(i)
+		var sum float32
+		for _, kv := range taps {
+			sum += kv.v * src[base+int(kv.k)]
+		}
+		dst[i] = sum
+	}
+}
+
+// Sum the rows of tmp, which has nsrc rows of len(acc) samples, into
+// acc with the taps of the target row y. Returns the number of taps.
+func resamplePlaneRows(acc, tmp []float32, nsrc int, k *kernel, border *float32, y int) int {
+	for i := range acc {
+		acc[i] = 0
+	}
+	w := len(acc)
+	base, taps := k.at(y)
+	for _, kv := range taps {
+		j := base + int(kv.k)
+		if j == nsrc {
+			b := kv.v * *border
+			for i := range acc {
+				acc[i] += b
+			}
+			continue
+		}
+		v := kv.v
+		for i, s := range tmp[j*w:][:w] {
+			acc[i] += v * s
+		}
+	}
+	return len(taps)
+}
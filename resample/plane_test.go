@@ -0,0 +1,91 @@
+package resample
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+func TestGrayTargets(t *testing.T) {
+	r := image.Rect(0, 0, 30, 20)
+	for _, src := range []image.Image{image.NewGray(r), image.NewGray16(r), image.NewNRGBA(r)} {
+		img, err := Resize(nil, image.Rect(0, 0, 10, 7), src, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := newTargetImage(src, image.Rectangle{})
+		if img.ColorModel() != want.ColorModel() {
+			t.Errorf("%T resized into a %T", src, img)
+		}
+		plan, _ := Prepare(image.Rect(0, 0, 10, 7), r, Options{})
+		bytes := map[color.Model]int{color.GrayModel: 1, color.Gray16Model: 2, color.NRGBA64Model: 8}[want.ColorModel()]
+		if x := plan.Explain(nil, src); x.TargetBytes != 70*bytes || !x.Passes[0].From.Eq(r.Size()) {
+			t.Errorf("%T: %d target bytes, want %d", src, x.TargetBytes, 70*bytes)
+		}
+	}
+}
+
+func TestGrayMatchesRGBA(t *testing.T) {
+	rnd := rand.New(rand.NewSource(4))
+	tests := []struct {
+		src, dst image.Rectangle
+		opt      Options
+		yFirst   bool
+	}{
+		{image.Rect(0, 0, 60, 400), image.Rect(0, 0, 50, 40), Options{}, true},
+		{image.Rect(0, 0, 60, 400), image.Rect(0, 0, 50, 40), Options{Filter: Triangle, YBoundary: Constant(color.White)}, true},
+		{image.Rect(0, 0, 400, 60), image.Rect(0, 0, 40, 50), Options{XBoundary: Constant(color.Gray{0x40})}, false},
+		{image.Rect(0, 0, 20, 15), image.Rect(0, 0, 70, 33), Options{XBoundary: Constant(color.Gray{0x40})}, true},
+	}
+	for _, test := range tests {
+		src := image.NewGray16(test.src)
+		for i := range src.Pix {
+			src.Pix[i] = uint8(rnd.Intn(256))
+		}
+		opt, err := test.opt.normalize()
+		if err != nil {
+			t.Fatal(err)
+		}
+		e, _ := newPlan(test.dst, test.src, opt).start(image.NewGray16(test.dst), src, nil, false)
+		if !e.main.gray || (e.main.first == yAxis) != test.yFirst {
+			t.Fatalf("%v to %v: gray %v, y first %v", test.src, test.dst, e.main.gray, e.main.first == yAxis)
+		}
+
+		gray, err := StartResize(nil, test.dst, src, test.src, test.opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rgba, err := StartResize(image.NewNRGBA64(test.dst), test.dst, src, test.src, test.opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, _ := gray.Wait()
+		b, _ := rgba.Wait()
+		if got := gray.Plan().Stats().Ops; got != int64(e.ops()) {
+			t.Errorf("%v to %v: %d taps, planned %d", test.src, test.dst, got, e.ops())
+		}
+		// The buffers are those Explain estimates.
+		plan, err := Prepare(test.dst, test.src, test.opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := new(Scratch)
+		if err := ResizeIntoWithScratch(image.NewGray16(test.dst), src, plan, s); err != nil {
+			t.Fatal(err)
+		}
+		if x := plan.Explain(image.NewGray16(test.dst), src); x.TempBytes+x.LineBytes != s.bytes() {
+			t.Errorf("%v to %v: %d bytes estimated, the Scratch holds %d",
+				test.src, test.dst, x.TempBytes+x.LineBytes, s.bytes())
+		}
+		for y := 0; y < test.dst.Dy(); y++ {
+			for x := 0; x < test.dst.Dx(); x++ {
+				g := a.(*image.Gray16).Gray16At(x, y).Y
+				c := b.(*image.NRGBA64).NRGBA64At(x, y)
+				if d := int(g) - int(c.R); d < -2 || d > 2 {
+					t.Fatalf("%v to %v, %+v: (%d, %d) is %#x, %#x as RGBA", test.src, test.dst, test.opt, x, y, g, c.R)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package resample
+
+import (
+	"image"
+	"time"
+)
+
+// The cheap resize of Options.Preview: a Box filter after the shrink
+// stage, about two taps per pixel and axis whatever the scale. o is
+// normalized already.
+func (o Options) preview() Options {
+	return Options{Filter: Box, XFilter: Box, YFilter: Box,
+		XBoundary: o.XBoundary, YBoundary: o.YBoundary,
+		HalfFloatIntermediate: o.HalfFloatIntermediate, Shrink: true,
+		MemoryLimit: o.MemoryLimit}
+}
+
+// A new image of the type of the target, the one newTargetImage
+// creates if dst is nil.
+func newPreviewImage(dst, src image.Image, r image.Rectangle) image.Image {
+	switch dst.(type) {
+	case *image.RGBA:
+		return image.NewRGBA(r)
+	case *image.NRGBA:
+		return image.NewNRGBA(r)
+	case *NRGBAF32:
+		return NewNRGBAF32(r)
+	case *image.Gray:
+		return image.NewGray(r)
+	case *image.Gray16:
+		return image.NewGray16(r)
+	case nil:
+		return newTargetImage(src, r)
+	}
+	return image.NewNRGBA64(r)
+}
+
+// Wraps the keepAlive and phase of the resize e to resample the
+// preview of Options.Preview at the first call of keepAlive after the
+// ProgressInterval, 100ms if unset. Quick resizes finish without a
+// preview. The preview gets a scratch of its own as the one of e is in
+// use, so it is skipped if both don't fit the memory limit. Its taps
+// are added to the total once it starts.
+func previewOnTick(e *execution, opt Options, started func(*Plan, int),
+	keepAlive func(int) bool, phase func(Phase),
+	preview func(image.Image) bool) (func(int) bool, func(Phase)) {
+	interval := opt.ProgressInterval
+	if interval <= 0 {
+		interval = defaultProgressInterval
+	}
+	due := time.Now().Add(interval)
+	current := PhaseSetup
+	setPhase := func(p Phase) {
+		current = p
+		phase(p)
+	}
+	tried := false
+	return func(ops int) bool {
+		if !tried && !time.Now().Before(due) {
+			tried = true
+			popt := opt.preview()
+			if opt.MemoryLimit > 0 {
+				popt.MemoryLimit = opt.MemoryLimit - e.explain().PeakBytes
+			}
+			if opt.MemoryLimit <= 0 || popt.MemoryLimit > 0 {
+				s := getScratch()
+				defer putScratch(s)
+				p := e.plan
+				if img, pe := startPreview(e.dst, p.dstRect, e.src, p.srcRect, popt, s); img != nil {
+					started(p, e.ops()+pe.ops())
+					phase(PhasePreview)
+					if !pe.run(keepAlive, ignorePhase) || !preview(img) {
+						return false
+					}
+					phase(current)
+				}
+			}
+		}
+		return keepAlive(ops)
+	}, setPhase
+}
+
+// Plans the preview of a resize into a new image with the options of
+// Options.preview. Returns a nil image if the preview doesn't fit the
+// memory limit.
+func startPreview(dst image.Image, dstRect image.Rectangle,
+	src image.Image, srcRect image.Rectangle, opt Options, s *Scratch) (image.Image, execution) {
+	preview := newPreviewImage(dst, src, dstRect)
+	e, err := newPlan(dstRect, srcRect, opt).start(preview, src, s, true)
+	if err != nil {
+		return nil, e
+	}
+	return preview, e
+}
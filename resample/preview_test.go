@@ -0,0 +1,54 @@
+package resample
+
+import (
+	"image"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// The steps of a resize into a new image up to the done one.
+func previewSteps(t *testing.T, src image.Image, interval time.Duration) (previews []DetailedStep, last DetailedStep) {
+	t.Helper()
+	opt := Options{Filter: Lanczos3, Preview: true, ProgressInterval: interval}
+	steps, _, err := ResizeToChannelWithOptions(nil, image.Rect(0, 0, 300, 100), src, src.Bounds(), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for st := range steps {
+		d := st.(DetailedStep)
+		if d.Done() {
+			return previews, d
+		}
+		if d.Image() != nil {
+			previews = append(previews, d)
+		}
+	}
+	return previews, nil
+}
+
+func TestPreview(t *testing.T) {
+	r := image.Rect(0, 0, 200, 150)
+	for _, src := range []image.Image{image.NewNRGBA(r), image.NewGray(r), image.NewGray16(r)} {
+		previews, last := previewSteps(t, src, time.Nanosecond)
+		if len(previews) != 1 {
+			t.Fatalf("%T: %d previews, want 1", src, len(previews))
+		}
+		p := previews[0]
+		if p.Phase() != PhasePreview || p.Image().Bounds() != image.Rect(0, 0, 300, 100) {
+			t.Errorf("%T: preview in %v of %v", src, p.Phase(), p.Image().Bounds())
+		}
+		if last.Err() != nil || last.Image() == p.Image() || last.Percent() != 100 {
+			t.Fatalf("%T: last step %+v", src, last)
+		}
+		if reflect.TypeOf(p.Image()) != reflect.TypeOf(last.Image()) {
+			t.Errorf("%T: preview is a %T, the image a %T", src, p.Image(), last.Image())
+		}
+	}
+}
+
+func TestPreviewOfQuickResize(t *testing.T) {
+	if previews, last := previewSteps(t, image.NewNRGBA(image.Rect(0, 0, 200, 150)), time.Hour); len(previews) != 0 || last.Err() != nil {
+		t.Errorf("%d previews before %+v, want none", len(previews), last)
+	}
+}
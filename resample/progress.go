@@ -0,0 +1,62 @@
+package resample
+
+import (
+	"fmt"
+)
+
+// The phases of a resize, see DetailedStep.Phase.
+//
+// There is no phase of its own for encoding the target format: the
+// second pass converts each line as it stores it, so the encoding is
+// part of PhaseSecondAxis and can't be told apart from it.
+type Phase int
+
+const (
+	// Checking the arguments and building the filter tables.
+	PhaseSetup Phase = iota
+	// The quick resize of Options.Preview.
+	PhasePreview
+	// The box filter of Options.Shrink.
+	PhaseShrink
+	// Resampling the first and the second axis. Resizes split into
+	// strips for the memory limit alternate between them.
+	PhaseFirstAxis
+	PhaseSecondAxis
+	// Finished, canceled or failed.
+	PhaseDone
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseSetup:
+		return "setup"
+	case PhasePreview:
+		return "preview"
+	case PhaseShrink:
+		return "shrink"
+	case PhaseFirstAxis:
+		return "first axis"
+	case PhaseSecondAxis:
+		return "second axis"
+	case PhaseDone:
+		return "done"
+	}
+	return fmt.Sprintf("Phase(%d)", int(p))
+}
+
+// The phases of the passes of the shrink and the main stage.
+var (
+	shrinkPhases = [2]Phase{PhaseShrink, PhaseShrink}
+	mainPhases   = [2]Phase{PhaseFirstAxis, PhaseSecondAxis}
+)
+
+func ignorePhase(Phase) {}
+
+// Turns a panic of a resize into an error, for the goroutines running
+// them. Nothing in the package should panic, but if it does it mustn't
+// take the program with it.
+func recoverResize(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("Resize failed: %v", r)
+	}
+}
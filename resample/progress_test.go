@@ -0,0 +1,67 @@
+package resample
+
+import (
+	"errors"
+	"image"
+	"testing"
+	"time"
+)
+
+var _ DetailedStep = step{}
+
+func TestStepPercentRemaining(t *testing.T) {
+	img := image.NewNRGBA64(image.Rect(0, 0, 1, 1))
+	failed := errors.New("failed")
+	tests := []struct {
+		s         step
+		done      bool
+		percent   int
+		remaining time.Duration
+	}{
+		{step{}, false, 0, 0},
+		{step{total: 400, done: 100, elapsed: time.Second}, false, 25, 3 * time.Second},
+		{step{total: 400, done: 100, elapsed: time.Second, image: img, preview: true}, false, 25, 3 * time.Second},
+		{step{total: 400, done: 400, image: img, elapsed: time.Second}, true, 100, 0},
+		{step{total: 400, done: 100, err: failed}, true, 25, 0},
+	}
+	for i, tt := range tests {
+		if tt.s.Done() != tt.done || tt.s.Percent() != tt.percent || tt.s.Remaining() != tt.remaining {
+			t.Errorf("%d: done %v, %d%%, remaining %v; want %v, %d%%, %v", i,
+				tt.s.Done(), tt.s.Percent(), tt.s.Remaining(), tt.done, tt.percent, tt.remaining)
+		}
+	}
+}
+
+func TestPhases(t *testing.T) {
+	src := image.NewNRGBA64(image.Rect(0, 0, 300, 300))
+	opt := Options{Filter: Lanczos12, Shrink: true, ProgressInterval: time.Nanosecond}
+	steps, _, err := ResizeToChannelWithOptions(nil, image.Rect(0, 0, 80, 80), src, src.Rect, opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The phases never go back, and the elapsed time neither.
+	var last DetailedStep
+	seen := map[Phase]bool{}
+	for st := range steps {
+		d, ok := st.(DetailedStep)
+		if !ok {
+			t.Fatalf("%T isn't a DetailedStep", st)
+		}
+		if last != nil && (d.Phase() < last.Phase() || d.Elapsed() < last.Elapsed()) {
+			t.Errorf("%v after %v, elapsed %v after %v", d.Phase(), last.Phase(), d.Elapsed(), last.Elapsed())
+		}
+		seen[d.Phase()] = true
+		last = d
+		if d.Done() {
+			break
+		}
+	}
+	if last == nil || !last.Done() || last.Phase() != PhaseDone || last.Err() != nil {
+		t.Fatalf("last step %+v", last)
+	}
+	for _, p := range []Phase{PhaseShrink, PhaseFirstAxis, PhaseSecondAxis} {
+		if !seen[p] {
+			t.Errorf("no step in %v", p)
+		}
+	}
+}
@@ -1,33 +1,43 @@
 // Resample provides generic image resampling (resizing) functions.
 //
-// Note that the package was only tested via visual inspection
-// of images from http://testimages.tecnick.com . No automated
-// testing has been implemented.
+// Note that the package was also tested via visual inspection
+// of images from http://testimages.tecnick.com .
 //
-// For now the resampling creates image.NRGBA64 images. No other
-// target formats have been implemented. All image formats are
-// supported, there's only a fast path for NRGBA64 images though.
+// The resampling creates image.Gray or image.Gray16 images for sources
+// of these types, else image.NRGBA64 images, or writes into
+// image.NRGBA64, image.RGBA, image.NRGBA, image.Gray, image.Gray16 or the
+// float32 NRGBAF32 images of this package. All image formats are supported
+// as source, those without a fast path are read via At and their
+// premultiplied colours divided by alpha.
 //
-// Internally all calculations are done intermediary float32 RGBA values.
+// Internally all calculations are done intermediary float32 RGBA values,
+// or integers for 8-bit images.
 //
 // The simplest way to use this package is just to resize an image.
 // You'll just need to supply the source image and a new size.
 //
-// This will use the Catmull-Rom scaling filter and handle the image
+// This will use the Lanczos3 scaling filter and handle the image
 // boundaries by weighing the pixels close with a higher weight
 // accordingly.
 //
 // Example:
 //     // Double the size
-//     newSize := sourceImage.Bounds().Max.Mul(2)
-//     newImage, err := resample.Resize(newSize, sourceImage)
+//     newSize := sourceImage.Bounds().Size().Mul(2)
+//     newImage, err := resample.Resize(nil, image.Rectangle{Max: newSize},
+//         sourceImage, sourceImage.Bounds())
 //
 // An error can - theoretically - only occure when you supply
 // nonsensical input such as negative image sizes or a nil source
 // image.
 //
 // For more general usage - such as specifying the filter and
-// boundary handling see the ResizeToChannel and ResizeToChannelWithFilter functions.
+// boundary handling see the ResizeToChannel and ResizeToChannelWithOptions
+// functions and Options, or StartResize for a Job to wait for, cancel or
+// poll. Fit, Fill, Thumbnail and Pad keep the aspect ratio. A Plan
+// prepares many resizes of the same sizes, a Scheduler runs those of
+// interactive callers and a BatchResizer those of batches. MultiResize
+// resamples a source into several sizes, ResizeYCbCr the planes of an
+// image.YCbCr.
 //
 // Performance
 //
@@ -35,15 +45,15 @@
 //
 // For a (W,H) -> (NW,NH) upsampling with a Lancsoz3 filter it will do roughly
 // 24*min(NW*H+NW*NH, NW*NH + W*NH) floating point 32bit multiplications. That's
-// where the time is spent. No other optimizations have been done.
+// where the time is spent. See Options for the fast paths.
 //
 package resample
 
 import (
 	"errors"
 	"image"
-	"image/color"
 	"math"
+	"time"
 )
 
 const epsilon = 0.0000125
@@ -164,23 +174,35 @@ func Reject(x, min, max int) int {
 
 // This will cause the filter to see the picture
 // at the boundaries as if it where mirrored.
+//
+// The boundary pixel itself is not repeated. The picture is mirrored
+// as often as needed, so filters with a support larger than the
+// image are handled too.
 func Reflect(x, min, max int) int {
-	switch {
-	case x < min:
-		return 2*min - x
-	case x > max:
-		return 2*max - x
+	if min >= max {
+		if min == max {
+			return min
+		}
+		return -1
 	}
-	return x
+	period := 2 * (max - min)
+	x = mod(x-min, period)
+	if x > max-min {
+		x = period - x
+	}
+	return x + min
 }
 
 var (
 	ErrMissingFilter        = errors.New("Filter is invalid.")
 	ErrMissingWrapFunc      = errors.New("Wrap function is invalid.")
+	ErrMissingBoundary      = errors.New("Boundary is invalid.")
 	ErrSourceImageIsInvalid = errors.New("Source image is invalid.")
 	ErrTargetImageIsInvalid = errors.New("Target image is invalid.")
 	ErrTargetSizeIsInvalid  = errors.New("Target size is invalid.")
 	ErrLogicError           = errors.New("Programming error.")
+	ErrInvalidMode          = errors.New("Mode is invalid.")
+	ErrInvalidChromaSiting  = errors.New("Chroma siting is invalid.")
 )
 
 // A step of the resampling process. 
@@ -188,13 +210,38 @@ type Step interface {
 	// Returns true on the last step.
 	Done() bool
 
-	// The resampled image. Only guaranteed non-nil when done.
+	// The resampled image. Only guaranteed non-nil when done. With
+	// Options.Preview a step before carries the preview instead.
 	Image() image.Image
 
 	// Percentage done.
 	Percent() int
 }
 
+// The details of a step. All steps of the package implement it, the
+// steps of ResizeToChannel and its variants can be asserted to it.
+// Step itself stays as it is for the implementations outside.
+type DetailedStep interface {
+	Step
+
+	// What the resize is busy with.
+	Phase() Phase
+
+	// Time since the resize started.
+	Elapsed() time.Duration
+
+	// Estimated time until done, from the progress so far. Zero if
+	// nothing is done yet.
+	Remaining() time.Duration
+
+	// Why the resize failed. The step is done then, without an image.
+	Err() error
+
+	// The quality level of Options.Deadline the resize runs at,
+	// QualityRequested without a deadline.
+	Quality() Quality
+}
+
 type step struct {
 	// The result image. This is non-nil only once the resampling is finished.
 	image image.Image
@@ -203,18 +250,50 @@ type step struct {
 	// but corresponds to the number of actual operations that are performed.
 	// The percentage done can be retrieved via the Precent() method.
 	total, done int
+
+	phase   Phase
+	elapsed time.Duration
+	err     error
+
+	// The image is the one of Options.Preview.
+	preview bool
+
+	quality Quality
 }
 
 func (s step) Done() bool {
-	return s.image != nil
+	return s.image != nil && !s.preview || s.err != nil
 }
 
 func (s step) Image() image.Image {
 	return s.image
 }
 
+func (s step) Phase() Phase {
+	return s.phase
+}
+
+func (s step) Elapsed() time.Duration {
+	return s.elapsed
+}
+
+func (s step) Remaining() time.Duration {
+	if s.Done() || s.done <= 0 || s.done > s.total {
+		return 0
+	}
+	return time.Duration(float64(s.elapsed) * float64(s.total-s.done) / float64(s.done))
+}
+
+func (s step) Quality() Quality {
+	return s.quality
+}
+
+func (s step) Err() error {
+	return s.err
+}
+
 func (s step) Percent() int {
-	if s.Done() {
+	if s.Done() && s.err == nil {
 		return 100
 	}
 	if s.total == 0 {
@@ -223,25 +302,22 @@ func (s step) Percent() int {
 	return int(100 * float32(s.done) / float32(s.total))
 }
 
-// Create a new image.NRGBA64 with the size newSize and resampled
-// from src via the Catmull-Rom cubic filter. Boundaries are rejected.
-// Returns an error if the src is nil, or if the newSize is
+// Resample the srcRect part of src into the dstRect part of dst via
+// the Lanczos3 filter. Boundaries are rejected.
+//
+// If dst is nil a new image with the bounds dstRect is created: an
+// image.Gray or image.Gray16 for sources of these types, else an
+// image.NRGBA64. Gray targets receive the luma of the colours.
+// Returns an error if the src is nil, or if the dstRect is
 // negative in either dimension.
 func Resize(dst image.Image, dstRect image.Rectangle,
 	src image.Image, srcRect image.Rectangle) (image.Image, error) {
 
-	steps, _, err := ResizeToChannel(dst, dstRect, src, srcRect)
+	job, err := StartResize(dst, dstRect, src, srcRect, Options{})
 	if err != nil {
 		return nil, err
 	}
-
-	for {
-		img := <-steps
-		if img.Done() {
-			return img.Image(), nil
-		}
-	}
-	panic("Unreachable code reached. This is a BUG in go-resample.")
+	return job.Wait()
 }
 
 // Returns a blocking channel of Step.
@@ -249,6 +325,11 @@ func Resize(dst image.Image, dstRect image.Rectangle,
 // Once Step.Done() is true, the calculation has finished and the channel is closed.
 // You can use this to abort calculating larger image resamples or to show percentage
 // done indicators.
+//
+// The steps need to be received until done, or the calculation aborted
+// with a single send on the returned channel. Otherwise the goroutine
+// doing the work blocks forever. StartResize returns a Job instead,
+// which has no such pitfalls.
 func ResizeToChannel(dst image.Image, dstRect image.Rectangle,
 	src image.Image, srcRect image.Rectangle) (<-chan Step, chan<- bool, error) {
 	steps, done, err := ResizeToChannelWithFilter(dst, dstRect, src, srcRect, Lanczos3, Reject, Reject)
@@ -267,107 +348,384 @@ func ResizeToChannel(dst image.Image, dstRect image.Rectangle,
 func ResizeToChannelWithFilter(dst image.Image, dstRect image.Rectangle,
 	src image.Image, srcRect image.Rectangle,
 	F Filter, XWrap, YWrap WrapFunc) (<-chan Step, chan<- bool, error) {
-	if src == nil {
-		return nil, nil, ErrSourceImageIsInvalid
-	}
-	if F.Apply == nil || F.Support <= 0 {
-		return nil, nil, ErrMissingFilter
-	}
 	if XWrap == nil || YWrap == nil {
 		return nil, nil, ErrMissingWrapFunc
 	}
+	return ResizeToChannelWithBoundary(dst, dstRect, src, srcRect, F, XWrap, YWrap)
+}
 
-	var dstBounds image.Rectangle
-	if dst == nil {
-		dstBounds.Max = srcRect.Size()
-	} else {
-		dstBounds = dst.Bounds()
+// Like ResizeToChannelWithFilter, but the image boundaries are defined
+// by a Boundary per axis. This allows for constant border colours
+// next to the WrapFunc based boundaries.
+func ResizeToChannelWithBoundary(dst image.Image, dstRect image.Rectangle,
+	src image.Image, srcRect image.Rectangle,
+	F Filter, XBoundary, YBoundary Boundary) (<-chan Step, chan<- bool, error) {
+	if !validBoundary(XBoundary) || !validBoundary(YBoundary) {
+		return nil, nil, ErrMissingBoundary
 	}
+	return ResizeToChannelWithOptions(dst, dstRect, src, srcRect,
+		Options{Filter: F, XBoundary: XBoundary, YBoundary: YBoundary})
+}
 
-	newSize := dstRect.Size()
+// Options of a resampling. The zero value resamples like ResizeToChannel.
+type Options struct {
+	// The filter used for all channels and both axes. Lanczos3 if unset.
+	Filter Filter
+
+	// Overrides Filter for the horizontal or vertical axis, for example for
+	// anamorphic video frames.
+	XFilter, YFilter Filter
+
+	// If set the alpha channel is resampled with this filter on both
+	// axes instead, for example a crisp Box next to a Lanczos colour filter.
+	AlphaFilter Filter
+
+	// Treatment of the image boundaries. Reject if unset.
+	XBoundary, YBoundary Boundary
+
+	// The image between the two passes keeps float32 values. If set,
+	// float16 values are stored instead, halving its memory at the cost
+	// of precision (11 significant bits).
+	HalfFloatIntermediate bool
+
+	// For large reductions, first average blocks of pixels by the
+	// largest integer factor that keeps the image at least as big as the
+	// target, then apply the filters for the remaining factor of less
+	// than two. Like the shrink and reduce steps of libvips.
+	//
+	// The filter support then no longer grows with the reduction. A
+	// 12000 to 200 pixel Lanczos3 reduction takes roughly 60 additions
+	// and 6 taps per pixel and axis instead of 360 taps. The box prefilter lets through a little more
+	// aliasing and blurs a little more than the filter alone, which is
+	// hardly visible for photos but may be for fine regular patterns.
+	// The first step aligns the pixel centres like AlignCenters, the
+	// boundaries only apply to the second step. Ignored by AreaMode,
+	// which is exact and cheap for large reductions anyway.
+	Shrink bool
+
+	// FilterMode if unset, see AreaMode for the alternative.
+	Mode Mode
+
+	// By default the corner pixels of the source map onto those of the
+	// target. If set the pixel centres are aligned instead, the edges of
+	// both images coincide. Most other libraries do the latter, and it
+	// is what makes the integer factor fast paths of a Box filter apply,
+	// averaging blocks or replicating pixels. The mapping changes the
+	// output slightly. Ignored by AreaMode, which always aligns the edges.
+	AlignCenters bool
+
+	// If positive, the bytes a resize may allocate: the intermediate
+	// images, filter tables, line buffers and the target if it is
+	// created. Estimated before the resize starts, see Plan.Explain.
+	//
+	// Resizes exceeding it are resampled in strips of target rows, which
+	// only keep part of the intermediate image. Rows of the source under
+	// two strips are resampled twice. If even strips of a single row
+	// exceed the limit a *MemoryLimitError is returned, before the
+	// filter tables are built if they alone exceed it. Strips of gray
+	// images are resampled as four channels like other images, without
+	// the single channel path.
+	MemoryLimit int
+
+	// If positive, ResizeToChannelWithOptions sends a Step about every
+	// ProgressInterval instead of every 200000 taps, so the rate of
+	// updates no longer depends on the image size and the machine.
+	ProgressInterval time.Duration
+
+	// If set, ResizeToChannelWithOptions and StartResize resample a
+	// preview with a Box filter after a Shrink, which costs about two
+	// taps per pixel and axis, into an image of its own once the resize
+	// has run for the ProgressInterval, 100ms if unset. It is passed as
+	// the image of a step that isn't done yet, then the resize proceeds
+	// with the requested filters. Interactive viewers can show it while
+	// a slow filter like Lanczos12 runs. Quick resizes finish without.
+	//
+	// The preview is skipped if it and the resize together would exceed
+	// the MemoryLimit. Ignored by ResizeInto.
+	Preview bool
+
+	// If not zero, ResizeToChannelWithOptions and StartResize replace
+	// the filters by cheaper ones step by step, see Quality, until the
+	// resize is predicted to finish by then. If even the fastest level
+	// isn't, that one is used. The steps report the level.
+	//
+	// The deadline isn't enforced, a resize running late isn't
+	// canceled. The prediction comes from the sizes and the filter
+	// supports, scaled by the time the resizes so far took on the
+	// machine. Ignored by Prepare and ResizeInto.
+	Deadline time.Time
+
+	// The position of the chroma samples for ResizeYCbCr and
+	// ConvertYCbCr.
+	ChromaSiting ChromaSiting
+}
+
+func (f Filter) isSet() bool {
+	return f.Apply != nil || f.Support != 0
+}
+
+func (f Filter) valid() bool {
+	return f.Apply != nil && f.Support > 0
+}
+
+// Fill in defaults and validate the options.
+func (o Options) normalize() (Options, error) {
+	if !o.Filter.isSet() {
+		o.Filter = Lanczos3
+	}
+	if !o.XFilter.isSet() {
+		o.XFilter = o.Filter
+	}
+	if !o.YFilter.isSet() {
+		o.YFilter = o.Filter
+	}
+	if !o.Filter.valid() || !o.XFilter.valid() || !o.YFilter.valid() {
+		return o, ErrMissingFilter
+	}
+	if o.AlphaFilter.isSet() && !o.AlphaFilter.valid() {
+		return o, ErrMissingFilter
+	}
+	if o.XBoundary == nil {
+		o.XBoundary = WrapFunc(Reject)
+	}
+	if o.YBoundary == nil {
+		o.YBoundary = WrapFunc(Reject)
+	}
+	if !validBoundary(o.XBoundary) || !validBoundary(o.YBoundary) {
+		return o, ErrMissingBoundary
+	}
+	if !o.Mode.valid() {
+		return o, ErrInvalidMode
+	}
+	if !o.ChromaSiting.valid() {
+		return o, ErrInvalidChromaSiting
+	}
+	return o, nil
+}
 
-	if newSize.X < 0 || newSize.Y < 0 {
-		return nil, nil, ErrTargetSizeIsInvalid
+// Like ResizeToChannelWithFilter, with all settings given by opt.
+func ResizeToChannelWithOptions(dst image.Image, dstRect image.Rectangle,
+	src image.Image, srcRect image.Rectangle, opt Options) (<-chan Step, chan<- bool, error) {
+	opt, e, err := checkResize(dst, dstRect, src, srcRect, opt)
+	if err != nil {
+		return nil, nil, err
+	}
+	newSize := dstRect.Size()
+	quality := QualityRequested
+	if e != nil {
+		quality = e.plan.quality
 	}
 
 	resultChannel := make(chan Step)
 	doneChannel := make(chan bool)
+	start := time.Now()
 	// Code for the KeepAlive closure used to
 	// break the calulculation into blocks.
 	// Sends on the channel only happen every opIncrement
-	// operations. For now this is hardcoded to a reasonable value.
+	// operations, or every ProgressInterval if set.
 	var opCount, totalOps, lastOps, opIncrement int
 	opIncrement = 200 * 1000
+	var lastSend time.Time
+	phase := PhaseSetup
+	due := func() bool {
+		if opt.ProgressInterval > 0 {
+			return lastSend.IsZero() || time.Since(lastSend) >= opt.ProgressInterval
+		}
+		return opCount >= lastOps
+	}
 	keepAlive := func(ops int) bool {
 		opCount += ops
-		if opCount >= lastOps {
+		if due() {
 			select {
 			case <-doneChannel:
 				return false
-			case resultChannel <- step{image: nil, total: totalOps, done: opCount}:
+			case resultChannel <- step{total: totalOps, done: opCount, phase: phase,
+				elapsed: time.Since(start), quality: quality}:
 				lastOps += opIncrement
+				lastSend = time.Now()
 				return true
 			}
 		}
 		return true
 
 	}
-	sendImage := func(img image.Image) {
+	sendLast := func(img image.Image, err error) {
 		select {
-		case resultChannel <- step{image: img, total: totalOps, done: opCount}:
+		case resultChannel <- step{image: img, total: totalOps, done: opCount,
+			phase: PhaseDone, elapsed: time.Since(start), err: err, quality: quality}:
 		case <-doneChannel:
 		}
 	}
 
 	if newSize.X == 0 || newSize.Y == 0 {
-		go sendImage(image.NewNRGBA64(image.Rect(0, 0, newSize.X, newSize.Y)))
+		if dst == nil {
+			dst = newTargetImage(src, dstRect)
+		}
+		go sendLast(dst, nil)
 		return resultChannel, doneChannel, nil
 	}
 
 	go func() {
 		// Send first empty step before we do any real work.
-		keepAlive(0)
-
-		xFilter, xOps := makeDiscreteFilter(F, XWrap, dstRect.Dx(), srcRect.Dx())
-		yFilter, yOps := makeDiscreteFilter(F, YWrap, dstRect.Dy(), srcRect.Dy())
-
-		if dst == nil {
-			dst = image.NewNRGBA64(dstRect)
+		if !keepAlive(0) {
+			return
 		}
-		dst := dst.(*image.NRGBA64)
-
-		xy_ops := yOps*srcRect.Dx() + xOps*dstRect.Dy()
-		yx_ops := xOps*srcRect.Dy() + yOps*dstRect.Dx()
-
-		if xy_ops < yx_ops {
-			totalOps = xy_ops
-			tmpBounds := image.Rect(0, 0, srcRect.Dx(), dstRect.Dy())
-			var tmp *image.NRGBA64
-			if tmpBounds.Dx() < dstRect.Dx() {
-				tmp = image.NewNRGBA64(tmpBounds)
-			} else {
-				tmp = dst
-			}
-			resampleAxisNRGBA64(yAxis, keepAlive, tmp, tmpBounds, src, srcRect, yFilter)
-			resampleAxisNRGBA64(xAxis, keepAlive, dst, dstRect, tmp, tmpBounds, xFilter)
-		} else {
-			totalOps = yx_ops
-			tmpBounds := image.Rect(0, 0, dstRect.Dx(), srcRect.Dy())
-			var tmp *image.NRGBA64
-			if tmpBounds.Dy() < dstRect.Dy() {
-				tmp = image.NewNRGBA64(tmpBounds)
-			} else {
-				tmp = dst
+		started := func(_ *Plan, total int) { totalOps = total }
+		setPhase := func(p Phase) { phase = p }
+		preview := func(img image.Image) bool {
+			select {
+			case <-doneChannel:
+				return false
+			case resultChannel <- step{image: img, preview: true, total: totalOps, done: opCount,
+				phase: PhasePreview, elapsed: time.Since(start), quality: quality}:
+				return true
 			}
-			resampleAxisNRGBA64(xAxis, keepAlive, tmp, tmpBounds, src, srcRect, xFilter)
-			resampleAxisNRGBA64(yAxis, keepAlive, dst, dstRect, tmp, tmpBounds, yFilter)
 		}
-		//log.Printf("Resize %v -> %v %d kOps (xy =%d,yx =%d)",src.Bounds().Max, newSize,opCount/1000, xy_ops/1000, yx_ops/1000)
-		sendImage(dst)
+		img, err := runResize(dst, dstRect, src, srcRect, opt, e, started, keepAlive, setPhase, preview)
+		if err != ErrCanceled {
+			//log.Printf("Resize %v -> %v %d kOps",src.Bounds().Max, newSize,opCount/1000)
+			sendLast(img, err)
+		}
 	}()
 	return resultChannel, doneChannel, nil
 }
 
+// Validates a resize and fills in the defaults of the options. With a
+// memory limit or a deadline the resize is planned and started without
+// a Scratch too, else the execution is nil. The options are the ones of
+// the quality level used then.
+func checkResize(dst image.Image, dstRect image.Rectangle,
+	src image.Image, srcRect image.Rectangle, opt Options) (Options, *execution, error) {
+	if src == nil {
+		return opt, nil, ErrSourceImageIsInvalid
+	}
+	opt, err := opt.normalize()
+	if err != nil {
+		return opt, nil, err
+	}
+	if err := validateImages(dst, dstRect, src, srcRect); err != nil {
+		return opt, nil, err
+	}
+	if err := checkTables(dstRect, srcRect, opt); err != nil {
+		return opt, nil, err
+	}
+	if dstRect.Empty() || opt.MemoryLimit <= 0 && opt.Deadline.IsZero() {
+		return opt, nil, nil
+	}
+	// The type of a new target is what counts.
+	newTarget, target := dst == nil, dst
+	if newTarget {
+		target = newTargetImage(src, image.Rectangle{})
+	}
+	q := QualityRequested
+	if !opt.Deadline.IsZero() {
+		q = chooseQuality(target, dstRect, src, srcRect, opt)
+		opt = opt.atQuality(q)
+	}
+	plan := newPlan(dstRect, srcRect, opt)
+	plan.quality = q
+	e, err := plan.start(target, src, nil, newTarget)
+	if err != nil {
+		return opt, nil, err
+	}
+	return opt, &e, nil
+}
+
+// Runs a resize checked by checkResize, dst is created if nil. e is the
+// execution of checkResize, if any. Calls started with the plan and the
+// total number of taps once known, and phase before each pass. The run
+// is recorded in the Stats of the plan. With Options.Preview preview is
+// called with the preview image, see previewOnTick, and the resize
+// canceled if it returns false. Returns the target, ErrCanceled if the
+// resize was canceled, or the error of a panic.
+func runResize(dst image.Image, dstRect image.Rectangle,
+	src image.Image, srcRect image.Rectangle, opt Options, e *execution,
+	started func(*Plan, int), keepAlive func(int) bool, phase func(Phase),
+	preview func(image.Image) bool) (img image.Image, err error) {
+	defer recoverResize(&err)
+	newTarget := dst == nil
+	if newTarget {
+		dst = newTargetImage(src, dstRect)
+	}
+	if dstRect.Empty() {
+		started(nil, 0)
+		return dst, nil
+	}
+	if e == nil {
+		// Without a limit there is nothing to check.
+		planned, _ := newPlan(dstRect, srcRect, opt).start(dst, src, nil, newTarget)
+		e = &planned
+	}
+
+	s := getScratch()
+	defer putScratch(s)
+	e.use(dst, s)
+	started(e.plan, e.ops())
+	if opt.Preview {
+		keepAlive, phase = previewOnTick(e, opt, started, keepAlive, phase, preview)
+	}
+	t := time.Now()
+	if !e.run(keepAlive, phase) {
+		return nil, ErrCanceled
+	}
+	d := time.Since(t)
+	e.plan.record(e.ops(), d)
+	costs.observe(e, d)
+	return dst, nil
+}
+
+// The target created for src if none is given, see Resize.
+func newTargetImage(src image.Image, r image.Rectangle) image.Image {
+	switch src.(type) {
+	case *image.Gray:
+		return image.NewGray(r)
+	case *image.Gray16:
+		return image.NewGray16(r)
+	}
+	return image.NewNRGBA64(r)
+}
+
+// Validate the images and rectangles of a resize, dst may be nil.
+func validateImages(dst image.Image, dstRect image.Rectangle,
+	src image.Image, srcRect image.Rectangle) error {
+	if src == nil {
+		return ErrSourceImageIsInvalid
+	}
+	if dstRect.Dx() < 0 || dstRect.Dy() < 0 {
+		return ErrTargetSizeIsInvalid
+	}
+	if dst != nil {
+		switch dst.(type) {
+		case *image.NRGBA64, *NRGBAF32, *image.RGBA, *image.NRGBA, *image.Gray, *image.Gray16:
+		default:
+			return ErrTargetImageIsInvalid
+		}
+		if !dstRect.In(dst.Bounds()) {
+			return ErrTargetSizeIsInvalid
+		}
+	}
+	if !dstRect.Empty() && (srcRect.Empty() || !srcRect.In(src.Bounds())) {
+		return ErrSourceImageIsInvalid
+	}
+	return nil
+}
+
+// Cost of moving the given bytes of the intermediate image through
+// memory, in taps.
+func trafficCost(bytes int) int {
+	return tmpTransfers * bytes / bytesPerTap
+}
+
+const (
+	// The intermediate image is written once by the first pass and
+	// read once by the second.
+	tmpTransfers = 2
+	// A tap loads a 16 byte float32 pixel and does a multiply add per
+	// channel, which is dominated by the load. So moving 16 bytes of
+	// an image which doesn't fit into the cache costs about as much.
+	bytesPerTap = 16
+)
+
 type f32RGBA struct {
 	R, G, B, A float32
 }
@@ -391,59 +749,58 @@ const (
 
 // Index wrap(k) and filter v=F(k) precalculated.
 // Zero filter values are dropped in makeDiscreteFilter
+//
+// The layout is relied upon by the assembly implementations of dotRGBA.
 type kvPair struct {
-	k int
+	k int32
 	v float32
 }
 
-func makeDiscreteFilter(f Filter, wrap WrapFunc, ndst, nsrc int) ([][]kvPair, int) {
-	df := make([][]kvPair, ndst)
-	count := 0
-
-	// We want to map x=0, and x=maxX to map precicely to nx=0 and nx=nMaxX
-	// This explains the -1. This isn't obvious, as the scaling is now slightly
-	// different from the input - however this avoids artefacts at the X=maxX points
-	// Which are only vicible for certain input images...
-	// For example upscaling
-	// TESTIMAGES/ART/ART_R10_0120x0120/ART_R10_0120x0120_001.png
-	dst2src := float64(ndst-1) / float64(nsrc-1)
-
-	support := f.Support
-	fscale := 1.0
-	if dst2src < 1.0 {
-		// Downsampling.
-		support /= dst2src
-		fscale *= dst2src
-	}
-	nudge := 1e-8
-	for i := 0; i != ndst; i++ {
-		var sum_v float32
-
-		src_x := float64(i) / dst2src
-		min := int(math.Floor(src_x - support - nudge))
-		max := int(math.Ceil(src_x + support + nudge))
-
-		df[i] = make([]kvPair, 0, max-min+1)
-		for j := min; j <= max; j++ {
-			v := f.Apply(fscale*(float64(j)-src_x)) * fscale
-			k := wrap(j, 0, nsrc-1)
-			if 0 <= k && k < nsrc && v != 0 {
-				df[i] = append(df[i], kvPair{k, float32(v)})
-				count++
-				sum_v += float32(v)
-			}
-		}
-		// Rescaling so far hasn't been important for upscaling
-		// but it IS correct anyhow, so we keep the extra work.
-		// It SHOULD only kick in when due to rounding the
-		// pre-calculated filter has varying support.
-		rescale := float32(1.0) / sum_v
-		for j, kv := range df[i] {
-			df[i][j].v = rescale * kv.v
-		}
-		//log.Println(min, max, max-min, support,  sum_v, df[i])
+// The discrete filter of one axis.
+type axisFilter struct {
+	taps *kernel
+	// Taps of the alpha channel, nil if taps is used for alpha too.
+	alpha *kernel
+	// Colour referenced by taps to the index nsrc, nil without border.
+	border *f32RGBA
+	// Number of taps per resampled line.
+	ops int
+}
+
+func makeAxisFilter(f, alpha Filter, b Boundary, ndst, nsrc int, centers bool) axisFilter {
+	var af axisFilter
+	af.taps = makeKernel(f, b, ndst, nsrc, centers)
+	af.ops = af.taps.ops
+	if alpha.isSet() {
+		af.alpha = makeKernel(alpha, b, ndst, nsrc, centers)
+		af.ops += af.alpha.ops
 	}
-	return df, count
+	if b, ok := b.(borderBoundary); ok {
+		c := b.border()
+		af.border = &c
+	}
+	return af
+}
+
+// The filters of both axes for the mode of the options.
+func (o Options) axisFilters(dst, src image.Point) (x, y axisFilter) {
+	if o.Mode == AreaMode {
+		x.taps = makeAreaKernel(dst.X, src.X)
+		y.taps = makeAreaKernel(dst.Y, src.Y)
+		x.ops, y.ops = x.taps.ops, y.taps.ops
+		return
+	}
+	x = makeAxisFilter(o.XFilter, o.AlphaFilter, o.XBoundary, dst.X, src.X, o.AlignCenters)
+	y = makeAxisFilter(o.YFilter, o.AlphaFilter, o.YBoundary, dst.Y, src.Y, o.AlignCenters)
+	return
+}
+
+// Validate b, a nil WrapFunc stored in a Boundary is invalid too.
+func validBoundary(b Boundary) bool {
+	if w, ok := b.(WrapFunc); ok {
+		return w != nil
+	}
+	return b != nil
 }
 
 const (
@@ -451,9 +808,11 @@ const (
 	f32_to_uint16 = float32(uint16(0xffff))
 )
 
-func fetchLineNRGBA64(flipXY bool, column []f32RGBA, x int, src *image.NRGBA64) {
-	dy := src.Bounds().Min.Y
-	dx := src.Bounds().Min.X
+// Fetch the line x of the image area starting at origin. Without flipXY
+// the line is a column, otherwise a row.
+func fetchLineNRGBA64(flipXY bool, column []f32RGBA, x int, src *image.NRGBA64, origin image.Point) {
+	dy := origin.Y
+	dx := origin.X
 	pix := src.Pix
 	var idx int
 	for y := 0; y != len(column); y++ {
@@ -469,15 +828,104 @@ func fetchLineNRGBA64(flipXY bool, column []f32RGBA, x int, src *image.NRGBA64)
 	}
 }
 
-func fetchLine(flipXY bool, column []f32RGBA, x int, src image.Image) {
+func fetchLineNRGBAF32(flipXY bool, column []f32RGBA, x int, src *NRGBAF32, origin image.Point) {
+	dy := origin.Y
+	dx := origin.X
+	pix := src.Pix
+	var idx int
+	for y := 0; y != len(column); y++ {
+		if flipXY {
+			idx = src.PixOffset(y+dx, x+dy)
+		} else {
+			idx = src.PixOffset(x+dx, y+dy)
+		}
+		column[y] = f32RGBA{pix[idx+0], pix[idx+1], pix[idx+2], pix[idx+3]}
+	}
+}
+
+const (
+	uint8_to_f32 = 1.0 / float32(uint8(0xff))
+	f32_to_uint8 = float32(uint8(0xff))
+)
+
+// Fetch the channels of 8-bit images. Like all lines of the resampling
+// they aren't premultiplied, so the premultiplied ones of image.RGBA
+// are divided by alpha.
+func fetchLineUint8(flipXY bool, column []f32RGBA, x int,
+	pix []uint8, pixOffset func(x, y int) int, premultiplied bool, origin image.Point) {
+	dy := origin.Y
+	dx := origin.X
+	var idx int
+	for y := 0; y != len(column); y++ {
+		if flipXY {
+			idx = pixOffset(y+dx, x+dy)
+		} else {
+			idx = pixOffset(x+dx, y+dy)
+		}
+		s := pix[idx : idx+4 : idx+4]
+		a := uint8_to_f32 * float32(s[3])
+		scale := float32(uint8_to_f32)
+		if premultiplied {
+			if s[3] == 0 {
+				column[y] = f32RGBA{}
+				continue
+			}
+			scale = 1 / float32(s[3])
+		}
+		column[y] = f32RGBA{scale * float32(s[0]), scale * float32(s[1]), scale * float32(s[2]), a}
+	}
+}
+
+// Fetch gray pixels as opaque colours, wide selects two bytes per
+// pixel.
+func fetchLineGray(flipXY bool, column []f32RGBA, x int,
+	pix []uint8, pixOffset func(x, y int) int, wide bool, origin image.Point) {
+	dy := origin.Y
+	dx := origin.X
+	var idx int
+	for y := 0; y != len(column); y++ {
+		if flipXY {
+			idx = pixOffset(y+dx, x+dy)
+		} else {
+			idx = pixOffset(x+dx, y+dy)
+		}
+		var v float32
+		if wide {
+			v = uint16_to_f32 * float32(uint16(pix[idx])<<8|uint16(pix[idx+1]))
+		} else {
+			v = uint8_to_f32 * float32(pix[idx])
+		}
+		column[y] = f32RGBA{v, v, v, 1}
+	}
+}
+
+func fetchLine(flipXY bool, column []f32RGBA, x int, src image.Image, origin image.Point) {
 	switch src := src.(type) {
 	case *image.NRGBA64:
-		fetchLineNRGBA64(flipXY, column, x, src)
+		fetchLineNRGBA64(flipXY, column, x, src, origin)
+		return
+	case *NRGBAF32:
+		fetchLineNRGBAF32(flipXY, column, x, src, origin)
+		return
+	case *nrgbaF16:
+		fetchLineNRGBAF16(flipXY, column, x, src, origin)
+		return
+	case *image.RGBA:
+		fetchLineUint8(flipXY, column, x, src.Pix, src.PixOffset, true, origin)
+		return
+	case *image.NRGBA:
+		fetchLineUint8(flipXY, column, x, src.Pix, src.PixOffset, false, origin)
+		return
+	case *image.Gray:
+		fetchLineGray(flipXY, column, x, src.Pix, src.PixOffset, false, origin)
+		return
+	case *image.Gray16:
+		fetchLineGray(flipXY, column, x, src.Pix, src.PixOffset, true, origin)
 		return
-
 	}
-	dy := src.Bounds().Min.Y
-	dx := src.Bounds().Min.X
+	// Colors are premultiplied, divide by alpha.
+	dy := origin.Y
+	dx := origin.X
 	var r, g, b, a uint32
 	for y := 0; y != len(column); y++ {
 		if flipXY {
@@ -485,47 +933,208 @@ func fetchLine(flipXY bool, column []f32RGBA, x int, src image.Image) {
 		} else {
 			r, g, b, a = src.At(x+dx, y+dy).RGBA()
 		}
-		column[y].R = uint16_to_f32 * float32(r)
-		column[y].G = uint16_to_f32 * float32(g)
-		column[y].B = uint16_to_f32 * float32(b)
-		column[y].A = uint16_to_f32 * float32(a)
+		if a == 0 {
+			column[y] = f32RGBA{}
+			continue
+		}
+		scale := 1 / float32(a)
+		column[y] = f32RGBA{scale * float32(r), scale * float32(g), scale * float32(b), uint16_to_f32 * float32(a)}
+	}
+}
+
+func putLineNRGBA64(flipXY bool, column []f32RGBA, x int, dst *image.NRGBA64, origin image.Point) {
+	dy := origin.Y
+	dx := origin.X
+	pix := dst.Pix
+	var idx int
+	for y, dst_c := range column {
+		if flipXY {
+			idx = dst.PixOffset(y+dx, x+dy)
+		} else {
+			idx = dst.PixOffset(x+dx, y+dy)
+		}
+		r := clampF32ToUint16(f32_to_uint16 * dst_c.R)
+		g := clampF32ToUint16(f32_to_uint16 * dst_c.G)
+		b := clampF32ToUint16(f32_to_uint16 * dst_c.B)
+		a := clampF32ToUint16(f32_to_uint16 * dst_c.A)
+		s := pix[idx : idx+8 : idx+8]
+		s[0], s[1] = uint8(r>>8), uint8(r)
+		s[2], s[3] = uint8(g>>8), uint8(g)
+		s[4], s[5] = uint8(b>>8), uint8(b)
+		s[6], s[7] = uint8(a>>8), uint8(a)
+	}
+}
+
+func clampF32ToUint8(x float32) uint8 {
+	if x > float32(uint8(0xff)) {
+		return uint8(0xff)
+	}
+	if x < 0 {
+		return 0
+	}
+	return uint8(x)
+}
+
+// The counterpart to fetchLineUint8, values are rounded and clamped.
+// The colours of image.RGBA are clamped before they are multiplied by
+// alpha, so they never exceed it.
+func putLineUint8(flipXY bool, column []f32RGBA, x int,
+	pix []uint8, pixOffset func(x, y int) int, premultiplied bool, origin image.Point) {
+	dy := origin.Y
+	dx := origin.X
+	var idx int
+	for y, dst_c := range column {
+		if flipXY {
+			idx = pixOffset(y+dx, x+dy)
+		} else {
+			idx = pixOffset(x+dx, y+dy)
+		}
+		s := pix[idx : idx+4 : idx+4]
+		scale := f32_to_uint8
+		if premultiplied {
+			scale *= clampUnit(dst_c.A)
+			dst_c.R, dst_c.G, dst_c.B = clampUnit(dst_c.R), clampUnit(dst_c.G), clampUnit(dst_c.B)
+		}
+		s[0] = clampF32ToUint8(scale*dst_c.R + 0.5)
+		s[1] = clampF32ToUint8(scale*dst_c.G + 0.5)
+		s[2] = clampF32ToUint8(scale*dst_c.B + 0.5)
+		s[3] = clampF32ToUint8(f32_to_uint8*dst_c.A + 0.5)
 	}
 }
 
-func putLineNRGBA64(flipXY bool, column []f32RGBA, x int, dst *image.NRGBA64) {
-	dy := dst.Bounds().Min.Y
-	dx := dst.Bounds().Min.X
+func clampUnit(x float32) float32 {
+	if x > 1 {
+		return 1
+	}
+	if x < 0 {
+		return 0
+	}
+	return x
+}
+
+// Values are stored as they are, without any clamping.
+func putLineNRGBAF32(flipXY bool, column []f32RGBA, x int, dst *NRGBAF32, origin image.Point) {
+	dy := origin.Y
+	dx := origin.X
+	pix := dst.Pix
+	var idx int
 	for y, dst_c := range column {
-		dst_nrgba := color.NRGBA64{
-			R: clampF32ToUint16(f32_to_uint16 * dst_c.R),
-			G: clampF32ToUint16(f32_to_uint16 * dst_c.G),
-			B: clampF32ToUint16(f32_to_uint16 * dst_c.B),
-			A: clampF32ToUint16(f32_to_uint16 * dst_c.A),
+		if flipXY {
+			idx = dst.PixOffset(y+dx, x+dy)
+		} else {
+			idx = dst.PixOffset(x+dx, y+dy)
 		}
+		pix[idx+0] = dst_c.R
+		pix[idx+1] = dst_c.G
+		pix[idx+2] = dst_c.B
+		pix[idx+3] = dst_c.A
+	}
+}
+
+// Stores the luma of the samples, alpha is dropped as gray images are
+// opaque. wide selects two bytes per pixel.
+func putLineGray(flipXY bool, column []f32RGBA, x int,
+	pix []uint8, pixOffset func(x, y int) int, wide bool, origin image.Point) {
+	dy := origin.Y
+	dx := origin.X
+	var idx int
+	for y, dst_c := range column {
 		if flipXY {
-			dst.SetNRGBA64(y+dx, x+dy, dst_nrgba)
+			idx = pixOffset(y+dx, x+dy)
+		} else {
+			idx = pixOffset(x+dx, y+dy)
+		}
+		if wide {
+			v := clampF32ToUint16(f32_to_uint16*luma(dst_c) + 0.5)
+			pix[idx+0], pix[idx+1] = uint8(v>>8), uint8(v)
 		} else {
-			dst.SetNRGBA64(x+dx, y+dy, dst_nrgba)
+			pix[idx] = clampF32ToUint8(f32_to_uint8*luma(dst_c) + 0.5)
 		}
 	}
 }
 
+func putLine(flipXY bool, column []f32RGBA, x int, dst image.Image, origin image.Point) {
+	switch dst := dst.(type) {
+	case *image.NRGBA64:
+		putLineNRGBA64(flipXY, column, x, dst, origin)
+	case *NRGBAF32:
+		putLineNRGBAF32(flipXY, column, x, dst, origin)
+	case *nrgbaF16:
+		putLineNRGBAF16(flipXY, column, x, dst, origin)
+	case *image.RGBA:
+		putLineUint8(flipXY, column, x, dst.Pix, dst.PixOffset, true, origin)
+	case *image.NRGBA:
+		putLineUint8(flipXY, column, x, dst.Pix, dst.PixOffset, false, origin)
+	case *image.Gray:
+		putLineGray(flipXY, column, x, dst.Pix, dst.PixOffset, false, origin)
+	case *image.Gray16:
+		putLineGray(flipXY, column, x, dst.Pix, dst.PixOffset, true, origin)
+	default:
+		panic("Unsupported target image. This is a BUG in go-resample.")
+	}
+}
+
+// Number of lines fetched, resampled and stored together.
+//
+// Columns are fetched and stored lineBlock pixels of a row at a time,
+// a blocked transpose into and out of the contiguous line buffers. So
+// both passes walk memory along rows, even with a whole-row stride
+// between the pixels of a column.
+const lineBlock = 16
+
+// Fetch the lines x0.. of src into lines, the first size values of each.
+// Columns are transposed via row, which holds len(lines) pixels.
+func fetchLines(flipXY bool, lines [][]f32RGBA, size, x0 int,
+	src image.Image, origin image.Point, row []f32RGBA) {
+	if flipXY {
+		for i, line := range lines {
+			fetchLine(true, line[:size], x0+i, src, origin)
+		}
+		return
+	}
+	row = row[:len(lines)]
+	origin.X += x0
+	for y := 0; y != size; y++ {
+		fetchLine(true, row, y, src, origin)
+		for i, c := range row {
+			lines[i][y] = c
+		}
+	}
+}
+
+// The counterpart of fetchLines.
+func putLines(flipXY bool, lines [][]f32RGBA, x0 int,
+	dst image.Image, origin image.Point, row []f32RGBA) {
+	if flipXY {
+		for i, line := range lines {
+			putLine(true, line, x0+i, dst, origin)
+		}
+		return
+	}
+	row = row[:len(lines)]
+	origin.X += x0
+	for y := range lines[0] {
+		for i := range row {
+			row[i] = lines[i][y]
+		}
+		putLine(true, row, y, dst, origin)
+	}
+}
+
 // Resample axis..
-func resampleAxisNRGBA64(axis axisSwitch, keepAlive func(int) bool,
-	dst *image.NRGBA64, dst_bbox image.Rectangle,
+func resampleAxis(axis axisSwitch, keepAlive func(int) bool,
+	dst image.Image, dst_bbox image.Rectangle,
 	src image.Image, src_bbox image.Rectangle,
-	f [][]kvPair) {
+	af axisFilter, s *Scratch) bool {
 	flip := axis != yAxis
 
-	dst_min_x, dst_max_x := dst_bbox.Min.X, dst_bbox.Max.X
-	dst_min_y, dst_max_y := dst_bbox.Min.Y, dst_bbox.Max.Y
+	dst_xsize, dst_ysize := dst_bbox.Dx(), dst_bbox.Dy()
 	ysize := src_bbox.Dy()
 	xsize := src_bbox.Dx()
 
 	if flip {
 		xsize, ysize = ysize, xsize
-		dst_min_x, dst_min_y = dst_min_y, dst_min_x
-		dst_max_x, dst_max_y = dst_max_y, dst_max_x
+		dst_xsize, dst_ysize = dst_ysize, dst_xsize
 	}
 
 	// This assertion is only triggered if the dst image
@@ -533,33 +1142,65 @@ func resampleAxisNRGBA64(axis axisSwitch, keepAlive func(int) bool,
 	// only happen from ResizeToChannelWithFilter right now
 	// and thus we keep the ugly panic to make sure we do
 	// use this function correctly.
-	if dst_max_x-dst_min_x != xsize {
+	if dst_xsize != xsize {
 		panic("Unfiltered axis must have preserved size.")
 	}
 
-	src_column := make([]f32RGBA, ysize)
-	dst_column := make([]f32RGBA, dst_max_y-dst_min_y)
+	// Lines are resampled in blocks of lineBlock lines. The border
+	// colour, if any, is kept behind each fetched line.
+	src_lines, dst_lines, row := s.lineBuffers(ysize, dst_ysize)
+	if af.border != nil {
+		for i := range src_lines {
+			src_lines[i] = append(src_lines[i], *af.border)
+		}
+	}
 
-	for x := dst_min_x; x != dst_max_x; x++ {
+	for x0 := 0; x0 < xsize; x0 += lineBlock {
 		var opCount int
-		fetchLine(flip, src_column, x, src)
-		y_i := 0
-		for y := dst_min_y; y != dst_max_y; y++ {
-			var dst_c f32RGBA
-			for _, f_y := range f[y_i] {
-				src_c := src_column[f_y.k]
+		n := xsize - x0
+		if n > lineBlock {
+			n = lineBlock
+		}
+		fetchLines(flip, src_lines[:n], ysize, x0, src, src_bbox.Min, row)
+		for i, src_column := range src_lines[:n] {
+			opCount += resampleLine(dst_lines[i], src_column, af)
+		}
+		putLines(flip, dst_lines[:n], x0, dst, dst_bbox.Min, row)
+		if !keepAlive(opCount) {
+			return false
+		}
+	}
+	return true
+}
+
+// Resample one line, the border colour behind src_column if af has
+// one. Returns the number of taps.
+func resampleLine(dst_column, src_column []f32RGBA, af axisFilter) int {
+	if af.alpha == nil && af.taps.kind != generalKernel {
+		return resampleIntegerFactor(dst_column, src_column, af.taps)
+	}
+	var opCount int
+	for y_i := range dst_column {
+		var dst_c f32RGBA
+		base, f := af.taps.at(y_i)
+		if af.alpha == nil {
+			dst_c = dotRGBA(src_column[base:], f)
+			opCount += len(f)
+		} else {
+			for _, f_y := range f {
+				src_c := src_column[base+int(f_y.k)]
 				dst_c.R += f_y.v * src_c.R
 				dst_c.G += f_y.v * src_c.G
 				dst_c.B += f_y.v * src_c.B
-				dst_c.A += f_y.v * src_c.A
 			}
-			dst_column[y_i] = dst_c
-			opCount += len(f[y_i])
-			y_i++
-		}
-		putLineNRGBA64(flip, dst_column, x, dst)
-		if !keepAlive(opCount) {
-			return
+			opCount += len(f)
+			base, f = af.alpha.at(y_i)
+			for _, f_y := range f {
+				dst_c.A += f_y.v * src_column[base+int(f_y.k)].A
+			}
+			opCount += len(f)
 		}
+		dst_column[y_i] = dst_c
 	}
+	return opCount
 }
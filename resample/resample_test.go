@@ -0,0 +1,139 @@
+package resample
+
+import (
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+)
+
+// Resizes all of src to a new NRGBAF32 of the given size.
+func resizeF32(t *testing.T, src image.Image, size image.Point, opt Options) *NRGBAF32 {
+	t.Helper()
+	dst := NewNRGBAF32(image.Rectangle{Max: size})
+	job, err := StartResize(dst, dst.Rect, src, src.Bounds(), opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := job.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	return dst
+}
+
+// An NRGBA64 image of random pixels, with opaque ones unless alpha.
+func randomNRGBA64(r image.Rectangle, alpha bool, rnd *rand.Rand) *image.NRGBA64 {
+	img := image.NewNRGBA64(r)
+	for i := range img.Pix {
+		img.Pix[i] = uint8(rnd.Intn(256))
+		if !alpha && i%8 >= 6 {
+			img.Pix[i] = 0xff
+		}
+	}
+	return img
+}
+
+// The largest difference of any channel of two images of equal bounds.
+func maxDiffF32(a, b *NRGBAF32) float32 {
+	var d float32
+	for i := range a.Pix {
+		d = maxF32(d, abs32(a.Pix[i]-b.Pix[i]))
+	}
+	return d
+}
+
+func maxF32(a, b float32) float32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func TestPerAxisFilters(t *testing.T) {
+	// Stripes varying only along one axis only see the filter of it.
+	xStripes := image.NewNRGBA64(image.Rect(0, 0, 6, 6))
+	yStripes := image.NewNRGBA64(image.Rect(0, 0, 6, 6))
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 6; x++ {
+			i := xStripes.PixOffset(x, y)
+			xStripes.Pix[i], xStripes.Pix[i+6] = uint8(x%2*0xff), 0xff
+			yStripes.Pix[i], yStripes.Pix[i+6] = uint8(y%2*0xff), 0xff
+		}
+	}
+	size := image.Pt(17, 17)
+	opt := Options{XFilter: Box, YFilter: Lanczos3, XBoundary: WrapFunc(Clamp), YBoundary: WrapFunc(Clamp)}
+	all := func(f Filter) Options {
+		o := opt
+		o.XFilter, o.YFilter = f, f
+		return o
+	}
+	if d := maxDiffF32(resizeF32(t, xStripes, size, opt), resizeF32(t, xStripes, size, all(Box))); d > 1e-5 {
+		t.Errorf("x stripes differ from Box on both axes by %g", d)
+	}
+	if d := maxDiffF32(resizeF32(t, yStripes, size, opt), resizeF32(t, yStripes, size, all(Lanczos3))); d > 1e-5 {
+		t.Errorf("y stripes differ from Lanczos3 on both axes by %g", d)
+	}
+}
+
+func TestAlphaFilter(t *testing.T) {
+	src := randomNRGBA64(image.Rect(0, 0, 9, 7), true, rand.New(rand.NewSource(1)))
+	size := image.Pt(20, 15)
+	mixed := resizeF32(t, src, size, Options{Filter: Lanczos3, AlphaFilter: Box})
+	colour := resizeF32(t, src, size, Options{Filter: Lanczos3})
+	alpha := resizeF32(t, src, size, Options{Filter: Box})
+	for i := range mixed.Pix {
+		want := colour.Pix[i]
+		if i%4 == 3 {
+			want = alpha.Pix[i]
+		}
+		if d := abs32(mixed.Pix[i] - want); d > 1e-5 {
+			t.Fatalf("channel %d of pixel %d is %g, want %g", i%4, i/4, mixed.Pix[i], want)
+		}
+	}
+}
+
+func TestInvalidOptions(t *testing.T) {
+	src := image.NewNRGBA64(image.Rect(0, 0, 4, 4))
+	r := image.Rect(0, 0, 2, 2)
+	tests := []struct {
+		opt  Options
+		want error
+	}{
+		{Options{XFilter: Filter{Support: 1}}, ErrMissingFilter},
+		{Options{AlphaFilter: Filter{Apply: box}}, ErrMissingFilter},
+		{Options{Mode: Mode(7)}, ErrInvalidMode},
+		{Options{ChromaSiting: ChromaSiting(-1)}, ErrInvalidChromaSiting},
+	}
+	for _, tt := range tests {
+		if _, _, err := ResizeToChannelWithOptions(nil, r, src, src.Bounds(), tt.opt); err != tt.want {
+			t.Errorf("%+v: %v, want %v", tt.opt, err, tt.want)
+		}
+	}
+}
+
+func TestTranslucentAtSource(t *testing.T) {
+	rnd := rand.New(rand.NewSource(6))
+	var palette color.Palette
+	for i := 0; i < 16; i++ {
+		palette = append(palette, color.NRGBA{uint8(rnd.Intn(256)), uint8(rnd.Intn(256)),
+			uint8(rnd.Intn(256)), uint8(64 + rnd.Intn(192))})
+	}
+	paletted := image.NewPaletted(image.Rect(0, 0, 40, 30), palette)
+	nrgba := image.NewNRGBA(paletted.Rect)
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 40; x++ {
+			paletted.SetColorIndex(x, y, uint8(rnd.Intn(len(palette))))
+			nrgba.Set(x, y, paletted.At(x, y))
+		}
+	}
+	// Read via At, whose colours are premultiplied, the resize matches
+	// the one of the straight ones.
+	hidden := struct{ image.Image }{paletted}
+	for _, size := range []image.Point{{13, 50}, {80, 20}} {
+		got := resizeF32(t, hidden, size, Options{})
+		want := resizeF32(t, nrgba, size, Options{})
+		if d := maxDiffF32(got, want); d > 1e-3 {
+			t.Errorf("%v: differs by %v from the NRGBA source", size, d)
+		}
+	}
+}
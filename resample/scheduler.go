@@ -0,0 +1,174 @@
+package resample
+
+import (
+	"image"
+	"sync"
+	"time"
+)
+
+// Runs the resizes of an interactive caller, such as a viewer resizing
+// on every window size or filter change, where only the newest request
+// matters.
+//
+// A request replaces the one waiting and cancels the one running. It
+// starts once no newer one arrived for the debounce time and the
+// canceled resize has stopped, so successive requests may share a
+// target image. Only steps of the newest request are delivered.
+type Scheduler struct {
+	debounce time.Duration
+
+	requests  chan schedulerRequest
+	steps     chan DetailedStep
+	quit      chan struct{}
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+type schedulerRequest struct {
+	dst, src         image.Image
+	dstRect, srcRect image.Rectangle
+	opt              Options
+}
+
+// How often the progress of a resize is sent if its options don't
+// set a ProgressInterval.
+const defaultProgressInterval = 100 * time.Millisecond
+
+// Creates a Scheduler waiting the debounce time for newer requests
+// before starting a resize. Close stops it.
+func NewScheduler(debounce time.Duration) *Scheduler {
+	s := &Scheduler{
+		debounce: debounce,
+		requests: make(chan schedulerRequest),
+		steps:    make(chan DetailedStep),
+		quit:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go s.loop()
+	return s
+}
+
+// Requests resizing srcRect of src into dstRect of dst, see
+// StartResize. Supersedes all earlier requests. Does nothing once the
+// Scheduler is closed.
+func (s *Scheduler) Resize(dst image.Image, dstRect image.Rectangle,
+	src image.Image, srcRect image.Rectangle, opt Options) {
+	select {
+	case s.requests <- schedulerRequest{dst, src, dstRect, srcRect, opt}:
+	case <-s.quit:
+	}
+}
+
+// The steps of the newest request. Progress steps, including the one
+// of Options.Preview, are sent every Options.ProgressInterval of the
+// request, 100ms if unset, and dropped while the receiver is busy. The
+// done step, with the image or the error of the request, is sent
+// unless a newer request arrives first. Closed by Close.
+func (s *Scheduler) Steps() <-chan DetailedStep {
+	return s.steps
+}
+
+// Cancels the running resize and returns once it has stopped, the
+// targets aren't written to afterwards.
+func (s *Scheduler) Close() {
+	s.closeOnce.Do(func() { close(s.quit) })
+	<-s.stopped
+}
+
+func (s *Scheduler) loop() {
+	defer close(s.stopped)
+	defer close(s.steps)
+
+	var (
+		pending *schedulerRequest
+		job     *Job
+		due     <-chan time.Time
+		ready   bool
+		ticker  *time.Ticker
+		tick    <-chan time.Time
+	)
+	stopTicker := func() {
+		if ticker != nil {
+			ticker.Stop()
+			ticker, tick = nil, nil
+		}
+	}
+	defer stopTicker()
+	// The ticker of a canceled job stops at once, it would deliver
+	// steps of a superseded request until the job has stopped.
+	request := func(r schedulerRequest) {
+		stopTicker()
+		if job != nil {
+			job.Cancel()
+		}
+		pending, ready = &r, false
+		due = time.After(s.debounce)
+	}
+	// Sends the done step of a request, false if it was superseded
+	// on the way.
+	deliver := func(st DetailedStep) bool {
+		select {
+		case s.steps <- st:
+			return true
+		case r := <-s.requests:
+			request(r)
+			return false
+		case <-s.quit:
+			return false
+		}
+	}
+
+	for {
+		var jobDone <-chan struct{}
+		if job != nil {
+			jobDone = job.Done()
+		}
+		select {
+		case r := <-s.requests:
+			request(r)
+
+		case <-due:
+			due, ready = nil, true
+
+		case <-jobDone:
+			stopTicker()
+			st := job.Progress()
+			job = nil
+			if pending == nil && st.Err() != ErrCanceled {
+				deliver(st)
+			}
+
+		case <-tick:
+			if st := job.Progress(); !st.Done() {
+				select {
+				case s.steps <- st:
+				default:
+				}
+			}
+
+		case <-s.quit:
+			if job != nil {
+				job.Cancel()
+				<-job.Done()
+			}
+			return
+		}
+
+		if ready && pending != nil && job == nil {
+			r := *pending
+			pending, ready = nil, false
+			var err error
+			job, err = StartResize(r.dst, r.dstRect, r.src, r.srcRect, r.opt)
+			if err != nil {
+				deliver(step{phase: PhaseDone, err: err})
+				continue
+			}
+			interval := r.opt.ProgressInterval
+			if interval <= 0 {
+				interval = defaultProgressInterval
+			}
+			ticker = time.NewTicker(interval)
+			tick = ticker.C
+		}
+	}
+}
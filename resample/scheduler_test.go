@@ -0,0 +1,35 @@
+package resample
+
+import (
+	"image"
+	"testing"
+	"time"
+)
+
+func TestSchedulerSupersedes(t *testing.T) {
+	src := image.NewNRGBA64(image.Rect(0, 0, 500, 500))
+	slow := Options{Filter: Lanczos12, ProgressInterval: time.Millisecond}
+	for _, wait := range []bool{false, true} {
+		debounce := 20 * time.Millisecond
+		if wait {
+			debounce = 0
+		}
+		s := NewScheduler(debounce)
+		s.Resize(nil, image.Rect(0, 0, 2000, 2000), src, src.Rect, slow)
+		if wait {
+			// The first request is running.
+			if st := <-s.Steps(); st.Done() {
+				t.Fatalf("first request done: %+v", st)
+			}
+		}
+		// The second one sends no progress, so any step but its done
+		// one belongs to the first.
+		dst := image.NewNRGBA(image.Rect(0, 0, 10, 10))
+		s.Resize(dst, dst.Rect, src, src.Rect, Options{ProgressInterval: time.Hour})
+		st := <-s.Steps()
+		if !st.Done() || st.Err() != nil || st.Image() != dst {
+			t.Errorf("waited %v: step %+v arrived, want the done step of the second request", wait, st)
+		}
+		s.Close()
+	}
+}
@@ -0,0 +1,214 @@
+package resample
+
+import (
+	"image"
+	"sync"
+)
+
+// Reusable buffers of a resize: the line buffers, the image between
+// the two passes and the image of the shrink stage. They grow to the
+// largest resize seen and are never shrunk, the pooled buffers of
+// ResizeInto are dropped instead if they grow too large.
+//
+// The zero value is ready to use. A Scratch must not be used by more
+// than one resize at a time.
+type Scratch struct {
+	lines              []f32RGBA
+	srcLines, dstLines [lineBlock][]f32RGBA
+
+	fixedLines                   []i32RGBA
+	fixedSrcLines, fixedDstLines [lineBlock][]i32RGBA
+
+	tmpF32   NRGBAF32
+	tmpF16   nrgbaF16
+	tmpFixed fixedImage
+
+	shrunkF32    NRGBAF32
+	shrunkF16    nrgbaF16
+	shrunkNRGBA  image.NRGBA
+	shrunkGray16 image.Gray16
+
+	// The buffers of resamplePlane.
+	planeTmp, planeLine, planeAcc []float32
+	planeRows                     []int
+}
+
+// The images of a nil Scratch, only their type is of interest.
+var (
+	noNRGBA image.NRGBA
+	noF32   NRGBAF32
+	noF16   nrgbaF16
+	noGray  image.Gray16
+)
+
+// Scratch buffers of the resizes without one of their own.
+var scratchPool = sync.Pool{New: func() interface{} { return new(Scratch) }}
+
+// The largest Scratch kept in scratchPool, in bytes. Larger ones are
+// left to the garbage collector, so a single huge resize doesn't keep
+// its buffers alive for the small ones that follow. This holds the
+// float32 intermediate image of a 1024x1024 target and more.
+const maxPooledScratch = 32 << 20
+
+func getScratch() *Scratch {
+	return scratchPool.Get().(*Scratch)
+}
+
+func putScratch(s *Scratch) {
+	if s.bytes() <= maxPooledScratch {
+		scratchPool.Put(s)
+	}
+}
+
+// The bytes held by the buffers of s.
+func (s *Scratch) bytes() int {
+	return 16*(cap(s.lines)+cap(s.fixedLines)) +
+		4*(cap(s.tmpF32.Pix)+cap(s.shrunkF32.Pix)) +
+		2*(cap(s.tmpF16.Pix)+cap(s.shrunkF16.Pix)+cap(s.tmpFixed.Pix)) +
+		cap(s.shrunkNRGBA.Pix) + cap(s.shrunkGray16.Pix) +
+		4*(cap(s.planeTmp)+cap(s.planeLine)+cap(s.planeAcc)) + 8*cap(s.planeRows)
+}
+
+func growF32(b []float32, n int) []float32 {
+	if cap(b) < n {
+		return make([]float32, n)
+	}
+	return b[:n]
+}
+
+func growUint16(b []uint16, n int) []uint16 {
+	if cap(b) < n {
+		return make([]uint16, n)
+	}
+	return b[:n]
+}
+
+func growUint8(b []uint8, n int) []uint8 {
+	if cap(b) < n {
+		return make([]uint8, n)
+	}
+	return b[:n]
+}
+
+// The line buffers of resampleAxis. The src lines have room for the
+// border colour behind them, the last lineBlock values are the row.
+func (s *Scratch) lineBuffers(ysize, dst_ysize int) (src, dst [][]f32RGBA, row []f32RGBA) {
+	n := lineBlock * (ysize + 1 + dst_ysize + 1)
+	if cap(s.lines) < n {
+		s.lines = make([]f32RGBA, n)
+	}
+	buf := s.lines[:n]
+	for i := range s.srcLines {
+		s.srcLines[i], buf = buf[:ysize:ysize+1], buf[ysize+1:]
+		s.dstLines[i], buf = buf[:dst_ysize], buf[dst_ysize:]
+	}
+	return s.srcLines[:], s.dstLines[:], buf
+}
+
+// Like lineBuffers, for resampleAxisFixed.
+func (s *Scratch) fixedLineBuffers(ysize, dst_ysize int) (src, dst [][]i32RGBA, row []i32RGBA) {
+	n := lineBlock * (ysize + dst_ysize + 1)
+	if cap(s.fixedLines) < n {
+		s.fixedLines = make([]i32RGBA, n)
+	}
+	buf := s.fixedLines[:n]
+	for i := range s.fixedSrcLines {
+		s.fixedSrcLines[i], buf = buf[:ysize], buf[ysize:]
+		s.fixedDstLines[i], buf = buf[:dst_ysize], buf[dst_ysize:]
+	}
+	return s.fixedSrcLines[:], s.fixedDstLines[:], buf
+}
+
+// The image between the two passes. Its values are neither quantised
+// nor clamped, unless half, so the second pass sees the exact result of
+// the first one. All its pixels are written by the first pass, so it
+// isn't cleared.
+func (s *Scratch) intermediate(r image.Rectangle, half bool) image.Image {
+	if half {
+		return s.tmpF16.reuse(r)
+	}
+	return s.tmpF32.reuse(r)
+}
+
+func (s *Scratch) fixedIntermediate(r image.Rectangle) *fixedImage {
+	w, h := r.Dx(), r.Dy()
+	pix := s.tmpFixed.Pix
+	if cap(pix) < 4*w*h {
+		pix = make([]int16, 4*w*h)
+	}
+	s.tmpFixed = fixedImage{Pix: pix[:4*w*h], Stride: 4 * w, Rect: r}
+	return &s.tmpFixed
+}
+
+// The image of the shrink stage, an NRGBA for 8-bit targets so they
+// stay in the fixed point pipeline without losing the colours of
+// translucent pixels, and Gray16 for gray targets.
+//
+// A nil Scratch returns an empty image of the type, for estimates.
+func (s *Scratch) shrunk(dst image.Image, r image.Rectangle, half bool) image.Image {
+	w, h := r.Dx(), r.Dy()
+	if s == nil {
+		switch dst.(type) {
+		case *image.RGBA, *image.NRGBA:
+			return &noNRGBA
+		case *image.Gray, *image.Gray16:
+			return &noGray
+		}
+	}
+	switch dst.(type) {
+	case *image.RGBA, *image.NRGBA:
+		s.shrunkNRGBA = image.NRGBA{Pix: growUint8(s.shrunkNRGBA.Pix, 4*w*h), Stride: 4 * w, Rect: r}
+		return &s.shrunkNRGBA
+	case *image.Gray, *image.Gray16:
+		s.shrunkGray16 = image.Gray16{Pix: growUint8(s.shrunkGray16.Pix, 2*w*h), Stride: 2 * w, Rect: r}
+		return &s.shrunkGray16
+	}
+	return s.shrunkFloat(r, half)
+}
+
+func (s *Scratch) shrunkFloat(r image.Rectangle, half bool) image.Image {
+	if s == nil {
+		if half {
+			return &noF16
+		}
+		return &noF32
+	}
+	if half {
+		return s.shrunkF16.reuse(r)
+	}
+	return s.shrunkF32.reuse(r)
+}
+
+// The intermediate image, source line and target line of
+// resamplePlane.
+func (s *Scratch) planeBuffers(ntmp, nline, nacc int) (tmp, line, acc []float32) {
+	s.planeTmp = growF32(s.planeTmp, ntmp)
+	s.planeLine = growF32(s.planeLine, nline)
+	s.planeAcc = growF32(s.planeAcc, nacc)
+	return s.planeTmp, s.planeLine, s.planeAcc
+}
+
+// The indices of the rows in the ring of resamplePlaneYX, none loaded.
+func (s *Scratch) planeRowBuffer(n int) []int {
+	if cap(s.planeRows) < n {
+		s.planeRows = make([]int, n)
+	}
+	s.planeRows = s.planeRows[:n]
+	for i := range s.planeRows {
+		s.planeRows[i] = -1
+	}
+	return s.planeRows
+}
+
+// Resize p to r, keeping its buffer if it is big enough.
+func (p *NRGBAF32) reuse(r image.Rectangle) *NRGBAF32 {
+	w, h := r.Dx(), r.Dy()
+	p.Pix, p.Stride, p.Rect = growF32(p.Pix, 4*w*h), 4*w, r
+	return p
+}
+
+func (p *nrgbaF16) reuse(r image.Rectangle) *nrgbaF16 {
+	w, h := r.Dx(), r.Dy()
+	p.Pix, p.Stride, p.Rect = growUint16(p.Pix, 4*w*h), 4*w, r
+	return p
+}
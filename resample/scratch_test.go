@@ -0,0 +1,49 @@
+package resample
+
+import (
+	"image"
+	"testing"
+)
+
+func TestResizeIntoAllocs(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 64, 48))
+	for _, dst := range []image.Image{
+		image.NewNRGBA(image.Rect(0, 0, 40, 100)),
+		image.NewNRGBA64(image.Rect(0, 0, 40, 100)),
+		NewNRGBAF32(image.Rect(0, 0, 40, 100)),
+	} {
+		plan, err := Prepare(dst.Bounds(), src.Rect, Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := new(Scratch)
+		if err := ResizeIntoWithScratch(dst, src, plan, s); err != nil {
+			t.Fatal(err)
+		}
+		if n := testing.AllocsPerRun(20, func() { ResizeIntoWithScratch(dst, src, plan, s) }); n != 0 {
+			t.Errorf("%T: %g allocations per resize with a Scratch", dst, n)
+		}
+		// The pool may be emptied by a garbage collection in between.
+		if n := testing.AllocsPerRun(20, func() { ResizeInto(dst, src, plan) }); n > 1 {
+			t.Errorf("%T: %g allocations per resize", dst, n)
+		}
+	}
+}
+
+func TestScratchPoolDropsLarge(t *testing.T) {
+	s := new(Scratch)
+	s.intermediate(image.Rect(0, 0, 2048, 2048), false)
+	if s.bytes() <= maxPooledScratch {
+		t.Fatalf("%d bytes, want more than %d", s.bytes(), maxPooledScratch)
+	}
+	putScratch(s)
+	if getScratch() == s {
+		t.Error("a Scratch beyond maxPooledScratch was pooled")
+	}
+
+	s = new(Scratch)
+	s.intermediate(image.Rect(0, 0, 64, 64), false)
+	if s.bytes() != 4*4*64*64 {
+		t.Errorf("%d bytes, want %d", s.bytes(), 4*4*64*64)
+	}
+}
@@ -0,0 +1,207 @@
+package resample
+
+import (
+	"fmt"
+	"image"
+)
+
+// Returned if a resize needs more memory than Options.MemoryLimit even
+// when resampled in strips of a single row.
+type MemoryLimitError struct {
+	// The limit and the smallest estimate, in bytes.
+	Limit, Needed int
+}
+
+func (e *MemoryLimitError) Error() string {
+	return fmt.Sprintf("Resize needs %d bytes, more than the memory limit of %d bytes.", e.Needed, e.Limit)
+}
+
+// Checks the filter tables of the main stage against the memory limit
+// before they are built. The full tables exist with strips too, so a
+// resize whose tables alone exceed the limit fails without building
+// them. The estimate is a lower bound, the exact check is Plan.start.
+func checkTables(dstRect, srcRect image.Rectangle, opt Options) error {
+	if opt.MemoryLimit <= 0 || dstRect.Empty() {
+		return nil
+	}
+	dst, src := dstRect.Size(), srcRect.Size()
+	if opt.Shrink && opt.Mode == FilterMode {
+		src = shrinkSize(dst, src)
+	}
+	needed := 0
+	for _, axis := range [...]struct {
+		f, alpha   Filter
+		ndst, nsrc int
+	}{{opt.XFilter, opt.AlphaFilter, dst.X, src.X}, {opt.YFilter, opt.AlphaFilter, dst.Y, src.Y}} {
+		if opt.Mode == AreaMode {
+			needed += minKernelBytes(Box, axis.ndst, axis.nsrc, true)
+			continue
+		}
+		needed += minKernelBytes(axis.f, axis.ndst, axis.nsrc, opt.AlignCenters)
+		if axis.alpha.isSet() {
+			needed += minKernelBytes(axis.alpha, axis.ndst, axis.nsrc, opt.AlignCenters)
+		}
+	}
+	if needed > opt.MemoryLimit {
+		return &MemoryLimitError{Limit: opt.MemoryLimit, Needed: needed}
+	}
+	return nil
+}
+
+// The least bytes of the kernel of makeKernel: a span per sample and
+// the taps of each sample or each phase of the polyphase bank. Samples
+// at the boundaries may lose half of their window, a window never has
+// more than nsrc taps, and the zeros of the filter drop a tap each, up
+// to one per unit of its support.
+func minKernelBytes(f Filter, ndst, nsrc int, centers bool) int {
+	m := newMapping(ndst, nsrc)
+	if centers {
+		m = centeredMapping(ndst, nsrc)
+	}
+	taps := 1
+	if m.dst2src < 1 {
+		half := int(f.Support / m.dst2src)
+		if half > nsrc {
+			half = nsrc
+		}
+		taps = maxInt(half-int(2*f.Support)-1, 1)
+	}
+	samples := ndst
+	if q, _ := m.period(); 2*q <= ndst {
+		samples = q
+	}
+	return 12*ndst + 8*taps*samples
+}
+
+// Resampling in strips.
+//
+// The image between the passes is the big allocation of a resize, it
+// has the full source height or width. With strips the target is
+// resampled a few rows at a time, x axis first, and only the rows of
+// the intermediate image under the taps of these rows exist. Rows under
+// two strips are resampled twice, so small strips cost extra taps.
+
+// The source samples [lo, hi) used by the samples [a, b) and their
+// number of taps. The border colour doesn't count.
+func (af axisFilter) window(a, b, nsrc int) (lo, hi, ops int) {
+	lo, hi = nsrc, 0
+	for _, k := range [...]*kernel{af.taps, af.alpha} {
+		if k == nil {
+			continue
+		}
+		for i := a; i < b; i++ {
+			base, taps := k.at(i)
+			for _, kv := range taps {
+				j := base + int(kv.k)
+				if j >= nsrc {
+					continue
+				}
+				if j < lo {
+					lo = j
+				}
+				if j >= hi {
+					hi = j + 1
+				}
+			}
+			ops += len(taps)
+		}
+	}
+	if hi <= lo {
+		// Only the border, one row is fetched anyway.
+		lo, hi = 0, 1
+	}
+	return lo, hi, ops
+}
+
+// The taps of the samples [a, b) for a source of the samples [lo, hi),
+// the border colour moves to hi-lo.
+func (k *kernel) strip(a, b, lo, hi, nsrc int) *kernel {
+	if k == nil {
+		return nil
+	}
+	sk := &kernel{spans: make([]kernelSpan, b-a)}
+	for i := a; i < b; i++ {
+		base, taps := k.at(i)
+		start := len(sk.taps)
+		for _, kv := range taps {
+			j := base + int(kv.k)
+			if j >= nsrc {
+				j = hi
+			}
+			sk.taps = append(sk.taps, kvPair{int32(j - lo), kv.v})
+		}
+		sk.spans[i-a] = kernelSpan{0, int32(start), int32(len(taps))}
+		sk.ops += len(taps)
+	}
+	return sk
+}
+
+func (af axisFilter) strip(a, b, lo, hi, nsrc int) axisFilter {
+	s := axisFilter{taps: af.taps.strip(a, b, lo, hi, nsrc), alpha: af.alpha.strip(a, b, lo, hi, nsrc), border: af.border}
+	s.ops = s.taps.ops
+	if s.alpha != nil {
+		s.ops += s.alpha.ops
+	}
+	return s
+}
+
+// Switch p to strips of the given number of target rows.
+func (p *resizePasses) tile(rows int, xFilter, yFilter axisFilter, dstRect, srcRect image.Rectangle) {
+	p.first, p.second = xAxis, yAxis
+	p.firstFilter, p.secondFilter = xFilter, yFilter
+	p.rows = rows
+	p.tmpFits = false
+	// Strips resample all images as four channels.
+	p.gray = false
+	p.ops = 0
+	p.stripRows = 0
+	window := 0
+	for a := 0; a < dstRect.Dy(); a += rows {
+		b := a + rows
+		if b > dstRect.Dy() {
+			b = dstRect.Dy()
+		}
+		lo, hi, ops := yFilter.window(a, b, srcRect.Dy())
+		window = maxInt(window, hi-lo)
+		p.stripRows += hi - lo
+		p.ops += xFilter.ops*(hi-lo) + ops*dstRect.Dx()
+	}
+	p.tmpBounds = image.Rect(0, 0, dstRect.Dx(), window)
+}
+
+// Like resizePasses.run, for passes split into strips by tile.
+func (p resizePasses) runStrips(keepAlive func(int) bool, phase func(Phase), phases [2]Phase,
+	dst image.Image, dstRect image.Rectangle,
+	src image.Image, srcRect image.Rectangle, s *Scratch) bool {
+	nsrc := srcRect.Dy()
+	for a := 0; a < dstRect.Dy(); a += p.rows {
+		b := a + p.rows
+		if b > dstRect.Dy() {
+			b = dstRect.Dy()
+		}
+		lo, hi, _ := p.secondFilter.window(a, b, nsrc)
+		yFilter := p.secondFilter.strip(a, b, lo, hi, nsrc)
+
+		tmpBounds := image.Rect(0, 0, dstRect.Dx(), hi-lo)
+		srcStrip := image.Rect(srcRect.Min.X, srcRect.Min.Y+lo, srcRect.Max.X, srcRect.Min.Y+hi)
+		dstStrip := image.Rect(dstRect.Min.X, dstRect.Min.Y+a, dstRect.Max.X, dstRect.Min.Y+b)
+		var ok bool
+		if p.fixed {
+			tmp := s.fixedIntermediate(tmpBounds)
+			phase(phases[0])
+			ok = resampleAxisFixed(xAxis, keepAlive, tmp, tmpBounds, src, srcStrip, p.firstFilter, s)
+			phase(phases[1])
+			ok = ok && resampleAxisFixed(yAxis, keepAlive, dst, dstStrip, tmp, tmpBounds, yFilter, s)
+		} else {
+			tmp := s.intermediate(tmpBounds, p.half)
+			phase(phases[0])
+			ok = resampleAxis(xAxis, keepAlive, tmp, tmpBounds, src, srcStrip, p.firstFilter, s)
+			phase(phases[1])
+			ok = ok && resampleAxis(yAxis, keepAlive, dst, dstStrip, tmp, tmpBounds, yFilter, s)
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
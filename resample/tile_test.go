@@ -0,0 +1,89 @@
+package resample
+
+import (
+	"image"
+	"math/rand"
+	"testing"
+)
+
+func TestMemoryLimit(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	src := NewNRGBAF32(image.Rect(0, 0, 200, 300))
+	for i := range src.Pix {
+		src.Pix[i] = rnd.Float32()
+	}
+	for _, tt := range []struct {
+		size image.Point
+		opt  Options
+	}{
+		{image.Pt(150, 400), Options{}},
+		{image.Pt(60, 90), Options{}},
+		{image.Pt(170, 250), Options{HalfFloatIntermediate: true}},
+		{image.Pt(40, 30), Options{Shrink: true}},
+	} {
+		want := resizeF32(t, src, tt.size, tt.opt)
+		dstRect := image.Rectangle{Max: tt.size}
+		plan, err := Prepare(dstRect, src.Rect, tt.opt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		limited := tt.opt
+		limited.MemoryLimit = plan.Explain(want, src).PeakBytes * 2 / 3
+		plan, err = Prepare(dstRect, src.Rect, limited)
+		if err != nil {
+			t.Fatal(err)
+		}
+		x := plan.Explain(want, src)
+		strips := false
+		for _, p := range x.Passes {
+			strips = strips || p.StripRows > 0
+		}
+		if x.PeakBytes > limited.MemoryLimit || !strips {
+			t.Errorf("%v: peak %d, limit %d, strips %v", tt.size, x.PeakBytes, limited.MemoryLimit, strips)
+		}
+		got := NewNRGBAF32(dstRect)
+		s := new(Scratch)
+		if err := ResizeIntoWithScratch(got, src, plan, s); err != nil {
+			t.Fatal(err)
+		}
+		if n := s.bytes(); n > x.TempBytes+x.LineBytes {
+			t.Errorf("%v: the Scratch holds %d bytes, %d estimated", tt.size, n, x.TempBytes+x.LineBytes)
+		}
+		// Strips resample the x axis first, which may round differently.
+		tolerance := float32(1e-5)
+		if tt.opt.HalfFloatIntermediate {
+			tolerance = 1.0 / 512
+		}
+		if d := maxDiffF32(want, got); d > tolerance {
+			t.Errorf("%v: strips differ by %g", tt.size, d)
+		}
+	}
+}
+
+func TestMemoryLimitTables(t *testing.T) {
+	// The spans of the x axis alone take 120 MB, which isn't built.
+	dstRect := image.Rect(0, 0, 10000000, 1)
+	src := image.NewNRGBA64(image.Rect(0, 0, 10, 1))
+	if _, err := Prepare(dstRect, src.Rect, Options{MemoryLimit: 1 << 20}); err == nil {
+		t.Error("Prepare passed")
+	} else if _, ok := err.(*MemoryLimitError); !ok {
+		t.Errorf("Prepare: %v, want a *MemoryLimitError", err)
+	}
+	if _, err := StartResize(nil, dstRect, src, src.Rect, Options{MemoryLimit: 1 << 20}); err == nil {
+		t.Error("StartResize passed")
+	}
+}
+
+func TestMinKernelBytes(t *testing.T) {
+	// A lower bound of the tables built.
+	for _, f := range []Filter{Box, Triangle, Lanczos3} {
+		for _, n := range [][2]int{{10, 1000}, {999, 1000}, {1000, 10}, {333, 1000}, {500, 1000}, {1, 7}} {
+			for _, centers := range []bool{false, true} {
+				af := makeAxisFilter(f, Filter{}, WrapFunc(Reject), n[0], n[1], centers)
+				if min, got := minKernelBytes(f, n[0], n[1], centers), af.tableBytes(false); min > got {
+					t.Errorf("%d of %d, centers %v: at least %d bytes, %d built", n[0], n[1], centers, min, got)
+				}
+			}
+		}
+	}
+}
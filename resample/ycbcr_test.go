@@ -0,0 +1,281 @@
+package resample
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// An image.YCbCr of random colours, all inside the RGB gamut.
+func randomYCbCr(r image.Rectangle, ratio image.YCbCrSubsampleRatio, rnd *rand.Rand) *image.YCbCr {
+	img := image.NewYCbCr(r, ratio)
+	for i := range img.Y {
+		img.Y[i] = uint8(40 + rnd.Intn(176))
+	}
+	for i := range img.Cb {
+		img.Cb[i] = uint8(108 + rnd.Intn(41))
+		img.Cr[i] = uint8(108 + rnd.Intn(41))
+	}
+	return img
+}
+
+func TestResizeYCbCrMatchesResize(t *testing.T) {
+	rnd := rand.New(rand.NewSource(5))
+	srcRect := image.Rect(3, 1, 43, 31)
+	opts := []Options{{Filter: Triangle}, {Filter: Triangle, AlignCenters: true}, {Mode: AreaMode}}
+	for _, ratio := range []image.YCbCrSubsampleRatio{image.YCbCrSubsampleRatio444, image.YCbCrSubsampleRatio420} {
+		src := randomYCbCr(image.Rect(0, 0, 50, 40), ratio, rnd)
+		for _, opt := range opts {
+			for _, size := range []image.Point{{60, 45}, {17, 12}} {
+				got, err := ResizeYCbCr(src, srcRect, size, opt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				job, err := StartResize(nil, image.Rectangle{Max: size}, src, srcRect, opt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				img, err := job.Wait()
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := img.(*image.NRGBA64)
+				// The planes are linear in RGB, only the rounding to
+				// 8 bits differs. Chroma subsampled by Resize is read
+				// from the nearest sample instead.
+				for y := 0; y < size.Y; y++ {
+					for x := 0; x < size.X; x++ {
+						c := want.NRGBA64At(x, y)
+						Y, Cb, Cr := color.RGBToYCbCr(uint8((int(c.R)+128)>>8), uint8((int(c.G)+128)>>8), uint8((int(c.B)+128)>>8))
+						d := absInt(int(got.Y[got.YOffset(x, y)]) - int(Y))
+						if ratio == image.YCbCrSubsampleRatio444 {
+							i := got.COffset(x, y)
+							d = maxInt(d, maxInt(absInt(int(got.Cb[i])-int(Cb)), absInt(int(got.Cr[i])-int(Cr))))
+						}
+						if d > 2 {
+							t.Fatalf("%v %+v to %v: %v at (%d, %d), Resize gives %v",
+								ratio, opt, size, got.At(x, y), x, y, color.YCbCr{Y, Cb, Cr})
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// The luma position of the sample j of a plane, see planeAxis.
+func samplePos(j, s, o2 int) float64 {
+	return float64(s*j) + float64(o2)/2
+}
+
+func TestPlaneGeometry(t *testing.T) {
+	// Cb grows along x and Cr along y with the position of the samples,
+	// the chroma planes of a 4:2:0 source with an odd offset.
+	srcRect := image.Rect(3, 1, 43, 31)
+	src := image.NewYCbCr(image.Rect(0, 0, 50, 40), image.YCbCrSubsampleRatio420)
+	opts := []Options{{Filter: Triangle}, {Filter: Triangle, AlignCenters: true}, {Mode: AreaMode}}
+	for _, siting := range []ChromaSiting{ChromaCenter, ChromaLeft, ChromaTopLeft} {
+		ox, oy := siting.offset2(2, false), siting.offset2(2, true)
+		for y := 0; y < 20; y++ {
+			for x := 0; x < 25; x++ {
+				src.Cb[y*src.CStride+x] = uint8(30 + 4*samplePos(x, 2, ox))
+				src.Cr[y*src.CStride+x] = uint8(30 + 4*samplePos(y, 2, oy))
+			}
+		}
+		for _, opt := range opts {
+			opt.ChromaSiting = siting
+			for _, size := range []image.Point{{60, 45}, {17, 12}} {
+				dst, err := ResizeYCbCr(src, srcRect, size, opt)
+				if err != nil {
+					t.Fatal(err)
+				}
+				// The value expected of the sample i along an axis, false
+				// if it can't be told.
+				expect := func(i, o2, W2, min, max int) (float64, bool) {
+					W := max - min
+					p := samplePos(i, 2, o2)
+					if opt.Mode == AreaMode {
+						// The mean of the source samples over the area.
+						scale := float64(W) / float64(W2)
+						lo, hi := float64(min)+(p-1)*scale, float64(min)+(p+1)*scale
+						var sum, covered float64
+						for j := min / 2; j <= (max-1)/2; j++ {
+							q := samplePos(j, 2, o2)
+							if a, b := math.Max(lo, q-1), math.Min(hi, q+1); b > a {
+								sum += (b - a) * (30 + 4*q)
+								covered += b - a
+							}
+						}
+						return sum / covered, true
+					}
+					// A linear ramp is kept away from the edges.
+					u := float64(min) + p*float64(W)/float64(W2)
+					if !opt.AlignCenters {
+						u = float64(min) + 0.5 + (p-0.5)*float64(W-1)/float64(W2-1)
+					}
+					return 30 + 4*u, u > float64(min+6) && u < float64(max-6)
+				}
+				for y := 0; y < (size.Y+1)/2; y++ {
+					for x := 0; x < (size.X+1)/2; x++ {
+						if want, ok := expect(x, ox, size.X, srcRect.Min.X, srcRect.Max.X); ok {
+							if got := float64(dst.Cb[y*dst.CStride+x]); math.Abs(got-want) > 1 {
+								t.Fatalf("%v %+v to %v: Cb of (%d, %d) is %v, want %.1f", siting, opt, size, x, y, got, want)
+							}
+						}
+						if want, ok := expect(y, oy, size.Y, srcRect.Min.Y, srcRect.Max.Y); ok {
+							if got := float64(dst.Cr[y*dst.CStride+x]); math.Abs(got-want) > 1 {
+								t.Fatalf("%v %+v to %v: Cr of (%d, %d) is %v, want %.1f", siting, opt, size, x, y, got, want)
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestConvertYCbCr(t *testing.T) {
+	rnd := rand.New(rand.NewSource(7))
+	r := image.Rect(1, 2, 31, 22)
+	ratios := []image.YCbCrSubsampleRatio{
+		image.YCbCrSubsampleRatio444, image.YCbCrSubsampleRatio422, image.YCbCrSubsampleRatio420,
+		image.YCbCrSubsampleRatio440, image.YCbCrSubsampleRatio411, image.YCbCrSubsampleRatio410,
+	}
+	for _, from := range ratios {
+		src := randomYCbCr(r, from, rnd)
+		// Constant chroma stays so, whatever the filter.
+		for i := range src.Cb {
+			src.Cb[i], src.Cr[i] = 100, 150
+		}
+		for _, to := range ratios {
+			dst, err := ConvertYCbCr(src, to, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dst.Rect != r || dst.SubsampleRatio != to {
+				t.Fatalf("%v to %v: %v %v", from, to, dst.Rect, dst.SubsampleRatio)
+			}
+			for y := r.Min.Y; y < r.Max.Y; y++ {
+				for x := r.Min.X; x < r.Max.X; x++ {
+					if a, b := dst.Y[dst.YOffset(x, y)], src.Y[src.YOffset(x, y)]; a != b {
+						t.Fatalf("%v to %v: luma of (%d, %d) is %d, want %d", from, to, x, y, a, b)
+					}
+					if i := dst.COffset(x, y); dst.Cb[i] != 100 || dst.Cr[i] != 150 {
+						t.Fatalf("%v to %v: chroma of (%d, %d) is %d, %d", from, to, x, y, dst.Cb[i], dst.Cr[i])
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestConvertYCbCrInterpolates(t *testing.T) {
+	// A ramp of chroma samples at the centre of 2x2 pixels.
+	src := image.NewYCbCr(image.Rect(0, 0, 40, 20), image.YCbCrSubsampleRatio420)
+	for y := 0; y < 10; y++ {
+		for x := 0; x < 20; x++ {
+			src.Cb[y*src.CStride+x] = uint8(30 + 4*samplePos(x, 2, 2))
+		}
+	}
+	dst, err := ConvertYCbCr(src, image.YCbCrSubsampleRatio444, Options{Filter: Triangle})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Interpolated rather than the nearest sample, away from the edges.
+	for x := 2; x < 38; x++ {
+		want := 30 + 4*samplePos(x, 1, 1)
+		if got := float64(dst.Cb[dst.COffset(x, 5)]); math.Abs(got-want) > 1 {
+			t.Errorf("Cb of x = %d is %v, want %v", x, got, want)
+		}
+	}
+
+	// Back to 4:2:0 the ramp is as it was.
+	back, err := ConvertYCbCr(dst, image.YCbCrSubsampleRatio420, Options{Filter: Triangle})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for x := 1; x < 19; x++ {
+		if a, b := back.Cb[5*back.CStride+x], src.Cb[5*src.CStride+x]; absInt(int(a)-int(b)) > 1 {
+			t.Errorf("Cb of sample %d back in 4:2:0 is %d, want %d", x, a, b)
+		}
+	}
+}
+
+func TestConvertYCbCrErrors(t *testing.T) {
+	src := image.NewYCbCr(image.Rect(0, 0, 4, 4), image.YCbCrSubsampleRatio420)
+	if _, err := ConvertYCbCr(nil, image.YCbCrSubsampleRatio444, Options{}); err != ErrSourceImageIsInvalid {
+		t.Errorf("nil source: %v", err)
+	}
+	if _, err := ConvertYCbCr(src, image.YCbCrSubsampleRatio(-1), Options{}); err != ErrTargetImageIsInvalid {
+		t.Errorf("invalid ratio: %v", err)
+	}
+	if _, err := ConvertYCbCr(src, image.YCbCrSubsampleRatio444, Options{ChromaSiting: ChromaSiting(-1)}); err != ErrInvalidChromaSiting {
+		t.Errorf("invalid siting: %v", err)
+	}
+	empty := image.NewYCbCr(image.Rect(3, 3, 3, 3), image.YCbCrSubsampleRatio420)
+	if dst, err := ConvertYCbCr(empty, image.YCbCrSubsampleRatio444, Options{}); err != nil || !dst.Rect.Empty() {
+		t.Errorf("empty source: %v, %v", dst, err)
+	}
+}
+
+// ResizeYCbCr of a 4:2:0 photo against resampling it as RGBA.
+func BenchmarkResizeYCbCr(b *testing.B) {
+	src := randomYCbCr(image.Rect(0, 0, 1600, 1200), image.YCbCrSubsampleRatio420, rand.New(rand.NewSource(1)))
+	size := image.Pt(640, 480)
+	b.Run("planes", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := ResizeYCbCr(src, src.Rect, size, Options{}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("RGBA", func(b *testing.B) {
+		dst := image.NewNRGBA(image.Rectangle{Max: size})
+		plan, err := Prepare(dst.Rect, src.Rect, Options{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		for i := 0; i < b.N; i++ {
+			if err := ResizeInto(dst, src, plan); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestResizeYCbCrMemoryLimit(t *testing.T) {
+	src := randomYCbCr(image.Rect(0, 0, 70, 50), image.YCbCrSubsampleRatio420, rand.New(rand.NewSource(8)))
+	size := image.Pt(90, 40)
+	opt, err := Options{}.normalize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := planYCbCr(image.Rectangle{Max: size}, src.SubsampleRatio, src, src.Rect, opt, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	needed := p.bytes()
+	if _, err := ResizeYCbCr(src, src.Rect, size, Options{MemoryLimit: needed}); err != nil {
+		t.Errorf("limit of %d bytes: %v", needed, err)
+	}
+	_, err = ResizeYCbCr(src, src.Rect, size, Options{MemoryLimit: needed - 1})
+	if e, ok := err.(*MemoryLimitError); !ok || e.Needed != needed {
+		t.Errorf("limit of %d bytes: %v", needed-1, err)
+	}
+	if _, err := ConvertYCbCr(src, image.YCbCrSubsampleRatio444, Options{MemoryLimit: 10000}); err == nil {
+		t.Error("ConvertYCbCr to 4:4:4 within 10000 bytes")
+	}
+
+	// Rejected before the planes or the tables are allocated, the
+	// source has no pixels.
+	huge := &image.YCbCr{Rect: image.Rect(0, 0, 60000, 60000), SubsampleRatio: image.YCbCrSubsampleRatio420,
+		YStride: 60000, CStride: 30000}
+	for _, size := range []image.Point{{30000, 30000}, {1, 60000}} {
+		_, err := ResizeYCbCr(huge, huge.Rect, size, Options{MemoryLimit: 1 << 20})
+		if _, ok := err.(*MemoryLimitError); !ok {
+			t.Errorf("%v within 1 MiB: %v", size, err)
+		}
+	}
+}
@@ -18,7 +18,7 @@ import (
 	"path"
     _ "expvar"
     "net/http"
-// 	"time"
+	"time"
 )
 
 type namedFilter struct {
@@ -58,65 +58,51 @@ func ResizeLoop(req <-chan image.Point, fchan <-chan namedFilter,
 	baseSize := baseImage.Bounds().Max
 
 	workImage := image.NewNRGBA64(baseImage.Bounds())
-    
-	
-	var resizeChan <-chan resample.Step
-	var doneChan chan<- bool
-	
+
+	// Window resizes come in bursts, only the last size is resampled.
+	scheduler := resample.NewScheduler(50 * time.Millisecond)
+	defer scheduler.Close()
+
 	var newSize image.Point
 	newFilter := namedFilter{"Box", resample.Box}
 	for {
 		select {
 		case newFilter = <-fchan:
-			win.SetTitle(fmt.Sprintf("%s %s %v %v", newFilter.Name, path.Base(filename), baseSize, newSize))
-			log.Printf("%s %s %v %v", path.Base(filename), newFilter.Name, baseSize, newSize)
-            if resizeChan != nil {
-                doneChan <- true
-            }
-            if workImage.Bounds().Dx() < newSize.X || workImage.Bounds().Dy() < newSize.Y {
-                workImage = image.NewNRGBA64(image.Rectangle{Max:newSize})
-            }
-			resizeChan, doneChan, _ = resample.ResizeToChannelWithFilter(
-                workImage, image.Rectangle{Max:newSize},
-                baseImage, baseImage.Bounds(),
-				newFilter.F,
-				resample.Reject,
-				resample.Reject)
-
 		case newSize = <-req:
-			win.SetTitle(fmt.Sprintf("%s %s %v %v", newFilter.Name, path.Base(filename), baseSize, newSize))
-			log.Printf("%s %s %v %v", path.Base(filename), newFilter.Name, baseSize, newSize)
-            if resizeChan != nil {
-                doneChan <- true
-            }
-            if workImage.Bounds().Dx() < newSize.X || workImage.Bounds().Dy() < newSize.Y {
-                workImage = image.NewNRGBA64(image.Rectangle{Max:newSize})
-            }
-			resizeChan, doneChan, _ = resample.ResizeToChannelWithFilter(
-                workImage, image.Rectangle{Max:newSize},
-                baseImage, baseImage.Bounds(),
-				newFilter.F,
-				resample.Reject,
-				resample.Reject)
-
-		case step := <-resizeChan:
+		case step := <-scheduler.Steps():
 			if step.Done() {
+				if err := step.Err(); err != nil {
+					log.Printf("%s %v %v FAILED %s", path.Base(filename), baseSize, newSize, err)
+					continue
+				}
 				drawProgress(win, step.Percent())
-				log.Printf("%s %v %v DONE (%d%%)", path.Base(filename),
-					baseSize, newSize, step.Percent())
+				log.Printf("%s %v %v DONE (%d%%) in %s", path.Base(filename),
+					baseSize, newSize, step.Percent(), step.Elapsed())
 				screen := win.Screen()
-                workImage = step.Image().(*image.NRGBA64)
-				draw.Draw(screen, screen.Bounds(), workImage, image.ZP, draw.Src)
+				draw.Draw(screen, screen.Bounds(), step.Image(), image.ZP, draw.Src)
 				win.FlushImage()
-				resizeChan, doneChan = nil, nil
 			} else {
+				if preview := step.Image(); preview != nil {
+					// Shown until the filter is done.
+					screen := win.Screen()
+					draw.Draw(screen, screen.Bounds(), preview, image.ZP, draw.Src)
+					win.FlushImage()
+				}
 				drawProgress(win, step.Percent())
-				log.Printf("%s %v %v STEP (%d%%)", path.Base(filename),
-					baseSize, newSize, step.Percent())
+				log.Printf("%s %v %v %s (%d%%)", path.Base(filename),
+					baseSize, newSize, step.Phase(), step.Percent())
 			}
+			continue
 		}
+		win.SetTitle(fmt.Sprintf("%s %s %v %v", newFilter.Name, path.Base(filename), baseSize, newSize))
+		log.Printf("%s %s %v %v", path.Base(filename), newFilter.Name, baseSize, newSize)
+		if workImage.Bounds().Dx() < newSize.X || workImage.Bounds().Dy() < newSize.Y {
+			workImage = image.NewNRGBA64(image.Rectangle{Max: newSize})
+		}
+		scheduler.Resize(workImage, image.Rectangle{Max: newSize},
+			baseImage, baseImage.Bounds(),
+			resample.Options{Filter: newFilter.F, Preview: true})
 	}
-
 }
 
 func wdeMain() {